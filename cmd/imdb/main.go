@@ -0,0 +1,130 @@
+// Command imdb looks up torrents of a movie or tv episode by IMDb ID.
+//
+//	imdb [flags] <imdb id> [<season> <episode>]
+//
+// With --trace it writes a JSON report of every upstream request, cache
+// decision, provider outcome and filter step of the lookup. --filter takes
+// a filter expression, see torrent.CompileFilter. Episodes without results
+// are diagnosed, printing why nothing was found.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+func main() {
+	omdbKey := flag.String("omdb-key", os.Getenv("OMDB_API_KEY"), "OMDB API key, needed for title based providers")
+	timeout := flag.Duration("timeout", 20*time.Second, "timeout per provider")
+	trace := flag.String("trace", "", "write a JSON trace of the lookup to this file, - for stderr")
+	filter := flag.String("filter", "", `filter expression, e.g. 'seeders >= 20 && quality in ["1080p", "2160p"]'`)
+	verbose := flag.Bool("v", false, "log provider activity")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v [flags] <imdb id> [<season> <episode>]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(flag.Args(), *omdbKey, *timeout, *trace, *filter, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, omdbKey string, timeout time.Duration, trace, filter string, verbose bool) error {
+	if len(args) != 1 && len(args) != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := zap.NewNop()
+	if verbose {
+		var err error
+		if logger, err = zap.NewDevelopment(); err != nil {
+			return err
+		}
+	}
+
+	cache := torrent.NewInMemCache()
+	clients := []torrent.MagnetFinder{torrent.NewYTS(torrent.DefaultYTSOpts, cache, logger)}
+	var seasons torrent.SeasonGetter
+	if omdbKey != "" {
+		omdb := meta.NewOMDB(meta.DefaultOptions, omdbKey)
+		clients = append(clients, torrent.NewTPB(torrent.DefaultTPBOpts, cache, omdb, logger))
+		seasons = omdb
+	}
+	finder := torrent.NewTorrent(clients, timeout, logger)
+	if filter != "" {
+		stage, err := torrent.FilterExprStage(filter)
+		if err != nil {
+			return err
+		}
+		pipeline := torrent.DefaultPipeline
+		pipeline.Filter = stage
+		finder.SetPipeline(pipeline)
+	}
+
+	ctx := torrent.WithRequestID(context.Background(), strconv.FormatInt(time.Now().UnixNano(), 36))
+	collector := torrent.NewTraceCollector()
+	if trace != "" {
+		ctx = torrent.WithTrace(ctx, collector)
+	}
+
+	var results []torrent.Result
+	var err error
+	if len(args) == 1 {
+		results, err = finder.FindMovie(ctx, args[0])
+	} else {
+		season, serr := strconv.Atoi(args[1])
+		episode, eerr := strconv.Atoi(args[2])
+		if serr != nil || eerr != nil {
+			return fmt.Errorf("invalid season or episode: %v %v", args[1], args[2])
+		}
+		var diagnosis torrent.Diagnosis
+		diagnosis, err = torrent.NewDiagnoser(torrent.DefaultDiagnoserOpts, finder, seasons, logger).Diagnose(ctx, args[0], season, episode)
+		results = diagnosis.Results
+		if err == nil && diagnosis.Reason != "" {
+			fmt.Fprintf(os.Stderr, "no results: %v\n", diagnosis.Reason)
+		}
+	}
+
+	if trace != "" {
+		if terr := writeTrace(trace, collector, torrent.RequestID(ctx)); terr != nil {
+			return fmt.Errorf("couldn't write trace: %v", terr)
+		}
+	}
+	if err != nil && len(results) == 0 {
+		return err
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "partial results: %v\n", err)
+	}
+
+	for _, r := range results {
+		fmt.Printf("%v\t%v\t%v\t%v\n", r.Quality, r.Seeders, r.Name, r.MagnetURL)
+	}
+	return nil
+}
+
+func writeTrace(path string, collector *torrent.TraceCollector, requestID string) error {
+	var w io.Writer = os.Stderr
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	return collector.WriteJSON(w, requestID)
+}
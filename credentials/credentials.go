@@ -0,0 +1,169 @@
+// Package credentials resolves API keys for metadata and torrent providers
+// from static values, the environment, files or secret managers.
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by stores without the requested credential.
+var ErrNotFound = errors.New("credential not found")
+
+// Store resolves credentials by name, e.g. "omdb", "tmdb" or "jackett".
+// Providers ask for the credential before every request, so a store can
+// rotate keys without restarting anything.
+type Store interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+var (
+	_ Store = Static(nil)
+	_ Store = Env{}
+	_ Store = (*File)(nil)
+	_ Store = FetchFunc(nil)
+	_ Store = Chain(nil)
+	_ Store = (*cached)(nil)
+)
+
+// Resolve returns the credential name from store, or fallback if store is
+// nil. Providers use it so that a key passed to the constructor keeps
+// working.
+func Resolve(ctx context.Context, store Store, name, fallback string) (string, error) {
+	if store == nil {
+		return fallback, nil
+	}
+	credential, err := store.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get %v credential: %v", name, err)
+	}
+	return credential, nil
+}
+
+// Static is a fixed set of credentials.
+type Static map[string]string
+
+func (s Static) Get(_ context.Context, name string) (string, error) {
+	if credential, ok := s[name]; ok {
+		return credential, nil
+	}
+	return "", ErrNotFound
+}
+
+// Env reads credentials from environment variables named Prefix followed by
+// the upper case name, e.g. IMDB_OMDB for Prefix "IMDB_" and name "omdb".
+type Env struct {
+	Prefix string
+}
+
+func (e Env) Get(_ context.Context, name string) (string, error) {
+	if credential, ok := os.LookupEnv(e.Prefix + strings.ToUpper(name)); ok && credential != "" {
+		return credential, nil
+	}
+	return "", ErrNotFound
+}
+
+// File reads credentials from a JSON object of names to credentials. The
+// file is read again whenever it changes, so keys rotate with a file write.
+type File struct {
+	path        string
+	modified    time.Time
+	credentials map[string]string
+	lock        *sync.Mutex
+}
+
+func NewFile(path string) *File {
+	return &File{path: path, lock: &sync.Mutex{}}
+}
+
+func (f *File) Get(_ context.Context, name string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't stat credentials file: %v", err)
+	}
+	if f.credentials == nil || !info.ModTime().Equal(f.modified) {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", fmt.Errorf("couldn't read credentials file: %v", err)
+		}
+		var credentials map[string]string
+		if err = json.Unmarshal(data, &credentials); err != nil {
+			return "", fmt.Errorf("couldn't parse credentials file: %v", err)
+		}
+		f.credentials, f.modified = credentials, info.ModTime()
+	}
+
+	if credential, ok := f.credentials[name]; ok {
+		return credential, nil
+	}
+	return "", ErrNotFound
+}
+
+// FetchFunc adapts a secret manager client to a Store. Wrap it with Cached
+// to avoid a secret manager call per request.
+type FetchFunc func(ctx context.Context, name string) (string, error)
+
+func (f FetchFunc) Get(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// Chain returns the credential of the first store that has it.
+type Chain []Store
+
+func (c Chain) Get(ctx context.Context, name string) (string, error) {
+	for _, store := range c {
+		credential, err := store.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return credential, err
+	}
+	return "", ErrNotFound
+}
+
+type cachedCredential struct {
+	value   string
+	fetched time.Time
+}
+
+type cached struct {
+	store       Store
+	ttl         time.Duration
+	credentials map[string]cachedCredential
+	lock        *sync.Mutex
+}
+
+// Cached keeps credentials of store for ttl, after which rotated
+// credentials are picked up.
+func Cached(store Store, ttl time.Duration) Store {
+	return &cached{
+		store:       store,
+		ttl:         ttl,
+		credentials: map[string]cachedCredential{},
+		lock:        &sync.Mutex{},
+	}
+}
+
+func (c *cached) Get(ctx context.Context, name string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if credential, ok := c.credentials[name]; ok && time.Since(credential.fetched) < c.ttl {
+		return credential.value, nil
+	}
+	value, err := c.store.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.credentials[name] = cachedCredential{value: value, fetched: time.Now()}
+	return value, nil
+}
@@ -0,0 +1,53 @@
+package credentials
+
+import (
+	"net/url"
+	"strings"
+)
+
+// sensitiveParams are query parameters which carry credentials.
+var sensitiveParams = map[string]bool{
+	"apikey":       true,
+	"api_key":      true,
+	"access_token": true,
+	"token":        true,
+	"password":     true,
+	"passkey":      true,
+}
+
+// Redact hides a credential for logs. Empty credentials stay empty, so a
+// missing key is still visible.
+func Redact(credential string) string {
+	if credential == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+// RedactURL hides the values of credential query parameters in rawURL.
+// Unparsable URLs are returned as "<invalid url>", since they might still
+// contain credentials.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+
+	query := u.Query()
+	redacted := false
+	for param := range query {
+		if sensitiveParams[strings.ToLower(param)] {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+		redacted = true
+	}
+	if !redacted {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -3,13 +3,12 @@ module github.com/jelliflix/imdb
 go 1.18
 
 require (
-	github.com/tidwall/gjson v1.14.0
+	github.com/andybalholm/brotli v1.1.0
 	go.uber.org/zap v1.21.0
+	golang.org/x/net v0.17.0
 )
 
 require (
-	github.com/tidwall/match v1.1.1 // indirect
-	github.com/tidwall/pretty v1.2.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 )
@@ -0,0 +1,249 @@
+// Package library reconciles an existing media collection with metadata,
+// reporting missing episodes and files worth upgrading.
+package library
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/parse"
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/watcher"
+	"go.uber.org/zap"
+)
+
+var (
+	videoExtensions = map[string]bool{".mkv": true, ".mp4": true, ".avi": true, ".m4v": true, ".ts": true, ".wmv": true, ".mov": true}
+	seasonDirRegex  = regexp.MustCompile(`(?i)^(season|series|staffel|saison)?[ ._-]*\d{1,2}$|^s\d{1,2}$|^specials$`)
+)
+
+var resolutionRanks = map[string]int{
+	"480p":  1,
+	"576p":  2,
+	"720p":  3,
+	"1080p": 4,
+	"2160p": 5,
+}
+
+// Searcher resolves titles to IMDb IDs, like meta.OMDB.
+type Searcher interface {
+	Search(ctx context.Context, q meta.Query) (meta.Candidate, error)
+}
+
+type Options struct {
+	// TargetResolution is the resolution files should have, e.g. "1080p".
+	// Files below it are reported as upgradable. Empty disables upgrades.
+	TargetResolution string
+}
+
+var DefaultOptions = Options{
+	TargetResolution: "1080p",
+}
+
+// File is a video file of the library with what its name tells.
+type File struct {
+	Path    string
+	Release parse.Release
+}
+
+type Episode struct {
+	Season  int
+	Episode int
+}
+
+// Title is a movie or series of the library. Missing lists the episodes
+// metadata knows of, in the seasons the library has, without a file.
+type Title struct {
+	IMDbID     string
+	Title      string
+	Year       int
+	Type       string
+	Files      []File
+	Missing    []Episode
+	Upgradable []File
+}
+
+// Report is the result of a reconciliation. Unresolved lists files whose
+// title couldn't be matched to an IMDb ID with confidence.
+type Report struct {
+	Titles     []Title
+	Unresolved []File
+}
+
+type Reconciler struct {
+	opts     Options
+	searcher Searcher
+	seasons  torrent.SeasonGetter
+	logger   *zap.Logger
+}
+
+// NewReconciler creates a reconciler. seasons may be nil, in which case
+// missing episodes aren't reported.
+func NewReconciler(opts Options, searcher Searcher, seasons torrent.SeasonGetter, logger *zap.Logger) *Reconciler {
+	return &Reconciler{
+		opts:     opts,
+		searcher: searcher,
+		seasons:  seasons,
+		logger:   logger,
+	}
+}
+
+// ParsePath parses a library path. Names without a title, like
+// "Season 1/S01E02.mkv", take it from the closest parent directory.
+func ParsePath(p string) File {
+	p = path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	base := path.Base(p)
+	release := parse.ParseRelease(strings.TrimSuffix(base, path.Ext(base)))
+
+	if release.Title == "" || release.Year == 0 {
+		for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			name := path.Base(dir)
+			if seasonDirRegex.MatchString(name) {
+				continue
+			}
+			parent := parse.ParseRelease(name)
+			if release.Title == "" {
+				release.Title = parent.Title
+			}
+			if release.Year == 0 {
+				release.Year = parent.Year
+			}
+			break
+		}
+	}
+
+	return File{Path: p, Release: release}
+}
+
+// Reconcile parses paths, resolves their titles and reports missing
+// episodes and upgradable files per title. Paths which aren't videos are
+// ignored.
+func (r *Reconciler) Reconcile(ctx context.Context, paths []string) (Report, error) {
+	type group struct {
+		query meta.Query
+		files []File
+	}
+	groups := map[string]*group{}
+	var keys []string
+	for _, p := range paths {
+		if !videoExtensions[strings.ToLower(path.Ext(p))] {
+			continue
+		}
+		file := ParsePath(p)
+		kind := "movie"
+		if file.Release.Season > 0 || len(file.Release.Episodes) > 0 {
+			kind = "series"
+		}
+		key := fmt.Sprintf("%v|%v|%v", kind, parse.NormalizeTitle(file.Release.Title), file.Release.Year)
+		if groups[key] == nil {
+			groups[key] = &group{query: meta.Query{Title: file.Release.Title, Year: file.Release.Year, Type: kind}}
+			keys = append(keys, key)
+		}
+		groups[key].files = append(groups[key].files, file)
+	}
+	sort.Strings(keys)
+
+	var report Report
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return Report{}, err
+		}
+
+		g := groups[key]
+		candidate, err := r.searcher.Search(ctx, g.query)
+		if err != nil {
+			torrent.ContextLogger(ctx, r.logger).Info("couldn't resolve library title", zap.Error(err),
+				zap.String("title", g.query.Title), zap.Int("year", g.query.Year))
+			report.Unresolved = append(report.Unresolved, g.files...)
+			continue
+		}
+
+		title := Title{
+			IMDbID: candidate.IMDbID,
+			Title:  candidate.Title,
+			Year:   candidate.Year,
+			Type:   g.query.Type,
+			Files:  g.files,
+		}
+		title.Upgradable = r.upgradable(g.files)
+		if title.Type == "series" && r.seasons != nil {
+			if title.Missing, err = r.missing(ctx, title.IMDbID, g.files); err != nil {
+				return Report{}, err
+			}
+		}
+		report.Titles = append(report.Titles, title)
+	}
+
+	return report, nil
+}
+
+func (r *Reconciler) upgradable(files []File) []File {
+	target := resolutionRanks[r.opts.TargetResolution]
+	if target == 0 {
+		return nil
+	}
+	var upgradable []File
+	for _, f := range files {
+		if resolutionRanks[f.Release.Resolution] < target {
+			upgradable = append(upgradable, f)
+		}
+	}
+	return upgradable
+}
+
+// missing returns the episodes of the seasons in files without a file.
+func (r *Reconciler) missing(ctx context.Context, seriesID string, files []File) ([]Episode, error) {
+	have := map[Episode]bool{}
+	seasons := map[int]bool{}
+	for _, f := range files {
+		seasons[f.Release.Season] = true
+		for _, e := range f.Release.Episodes {
+			have[Episode{Season: f.Release.Season, Episode: e}] = true
+		}
+	}
+
+	var seasonNumbers []int
+	for s := range seasons {
+		seasonNumbers = append(seasonNumbers, s)
+	}
+	sort.Ints(seasonNumbers)
+
+	var missing []Episode
+	for _, season := range seasonNumbers {
+		episodes, err := r.seasons.GetSeason(ctx, seriesID, season)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get season %v of %v: %v", season, seriesID, err)
+		}
+		for _, e := range episodes {
+			if !have[Episode{Season: season, Episode: e.Episode}] {
+				missing = append(missing, Episode{Season: season, Episode: e.Episode})
+			}
+		}
+	}
+	return missing, nil
+}
+
+// UpgradeEntries returns watcher entries for the upgradable files of
+// report, with the owned release as Have. Together with
+// watcher.Options.UpgradesOnly the watcher then reports quality upgrades.
+func UpgradeEntries(report Report) []watcher.Entry {
+	var entries []watcher.Entry
+	for _, t := range report.Titles {
+		for _, f := range t.Upgradable {
+			have := path.Base(f.Path)
+			if t.Type != "series" {
+				entries = append(entries, watcher.Entry{IMDbID: t.IMDbID, Have: have})
+				continue
+			}
+			for _, e := range f.Release.Episodes {
+				entries = append(entries, watcher.Entry{IMDbID: t.IMDbID, Season: f.Release.Season, Episode: e, Have: have})
+			}
+		}
+	}
+	return entries
+}
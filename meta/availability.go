@@ -0,0 +1,118 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Kinds of streaming offers.
+const (
+	OfferFlatrate = "flatrate"
+	OfferFree     = "free"
+	OfferAds      = "ads"
+	OfferRent     = "rent"
+	OfferBuy      = "buy"
+)
+
+// Offer is a way to watch a title legally, like a subscription service.
+type Offer struct {
+	Provider   string
+	ProviderID int
+	// Type is one of the Offer constants.
+	Type string
+}
+
+// Availability lists the offers for a title in one region. Link is the
+// TMDB page linking to the offers, as TMDB doesn't provide direct links.
+type Availability struct {
+	Region string
+	Link   string
+	Offers []Offer
+}
+
+// Streamable reports whether the title can be streamed without renting or
+// buying it, given a subscription where needed.
+func (a Availability) Streamable() bool {
+	for _, o := range a.Offers {
+		if o.Type == OfferFlatrate || o.Type == OfferFree || o.Type == OfferAds {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAvailability returns where a movie or series can be watched, keyed
+// by ISO 3166-1 region code like "US". Apps can prefer these offers and
+// only fall back to torrents where a title isn't streamable. The data is
+// provided by JustWatch through TMDB.
+func (t *TMDB) GetAvailability(ctx context.Context, imdbID string) (map[string]Availability, error) {
+	kind, id, err := t.mediaID(ctx, imdbID)
+	if err != nil {
+		return nil, err
+	}
+
+	type provider struct {
+		ID   int    `json:"provider_id"`
+		Name string `json:"provider_name"`
+	}
+	var v struct {
+		Results map[string]struct {
+			Link     string     `json:"link"`
+			Flatrate []provider `json:"flatrate"`
+			Free     []provider `json:"free"`
+			Ads      []provider `json:"ads"`
+			Rent     []provider `json:"rent"`
+			Buy      []provider `json:"buy"`
+		} `json:"results"`
+	}
+	if err = t.get(ctx, "/"+kind+"/"+strconv.Itoa(id)+"/watch/providers", nil, &v); err != nil {
+		return nil, fmt.Errorf("couldn't get watch providers of TMDB %v %v: %v", kind, id, err)
+	}
+
+	availability := map[string]Availability{}
+	for region, r := range v.Results {
+		a := Availability{Region: region, Link: r.Link}
+		for _, offers := range []struct {
+			kind      string
+			providers []provider
+		}{
+			{OfferFlatrate, r.Flatrate},
+			{OfferFree, r.Free},
+			{OfferAds, r.Ads},
+			{OfferRent, r.Rent},
+			{OfferBuy, r.Buy},
+		} {
+			for _, p := range offers.providers {
+				a.Offers = append(a.Offers, Offer{Provider: p.Name, ProviderID: p.ID, Type: offers.kind})
+			}
+		}
+		availability[region] = a
+	}
+	return availability, nil
+}
+
+// mediaID maps an IMDb ID to the TMDB media type, "movie" or "tv", and ID.
+func (t *TMDB) mediaID(ctx context.Context, imdbID string) (string, int, error) {
+	var v struct {
+		MovieResults []struct {
+			ID int `json:"id"`
+		} `json:"movie_results"`
+		TVResults []struct {
+			ID int `json:"id"`
+		} `json:"tv_results"`
+	}
+	params := url.Values{"external_source": {"imdb_id"}}
+	if err := t.get(ctx, "/find/"+url.PathEscape(imdbID), params, &v); err != nil {
+		return "", 0, fmt.Errorf("couldn't find %v on TMDB: %v", imdbID, err)
+	}
+
+	switch {
+	case len(v.MovieResults) > 0:
+		return "movie", v.MovieResults[0].ID, nil
+	case len(v.TVResults) > 0:
+		return "tv", v.TVResults[0].ID, nil
+	}
+	return "", 0, fmt.Errorf("couldn't find %v on TMDB", imdbID)
+}
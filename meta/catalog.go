@@ -0,0 +1,202 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CatalogKind selects a browsable list of titles.
+type CatalogKind string
+
+const (
+	CatalogTrending CatalogKind = "trending"
+	CatalogPopular  CatalogKind = "popular"
+	CatalogNew      CatalogKind = "new"
+)
+
+// ErrUnsupportedCatalog is returned for catalogs a source doesn't offer.
+var ErrUnsupportedCatalog = errors.New("unsupported catalog")
+
+// CatalogItem is a title in a catalog. Type is "movie" or "series".
+type CatalogItem struct {
+	Meta
+	Type string
+}
+
+// CatalogPage is one page of a catalog. Pages start at 1.
+type CatalogPage struct {
+	Items   []CatalogItem
+	Page    int
+	HasMore bool
+}
+
+// Catalog is a source of browsable title lists. typ is "movie" or "series".
+type Catalog interface {
+	GetCatalog(ctx context.Context, kind CatalogKind, typ string, page int) (CatalogPage, error)
+}
+
+var (
+	_ Catalog = (*TMDB)(nil)
+	_ Catalog = (*Cinemeta)(nil)
+)
+
+var tmdbCatalogPaths = map[CatalogKind]map[string]string{
+	CatalogTrending: {"movie": "/trending/movie/week", "series": "/trending/tv/week"},
+	CatalogPopular:  {"movie": "/movie/popular", "series": "/tv/popular"},
+	CatalogNew:      {"movie": "/movie/now_playing", "series": "/tv/on_the_air"},
+}
+
+// GetCatalog returns a page of a TMDB list. Titles without an IMDb ID are
+// left out, so pages can be shorter than TMDB's 20 results.
+func (t *TMDB) GetCatalog(ctx context.Context, kind CatalogKind, typ string, page int) (CatalogPage, error) {
+	path, ok := tmdbCatalogPaths[kind][typ]
+	if !ok {
+		return CatalogPage{}, fmt.Errorf("%w: %v %v", ErrUnsupportedCatalog, kind, typ)
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	var v struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+		Results    []struct {
+			ID           int    `json:"id"`
+			Title        string `json:"title"`
+			Name         string `json:"name"`
+			ReleaseDate  string `json:"release_date"`
+			FirstAirDate string `json:"first_air_date"`
+		} `json:"results"`
+	}
+	if err := t.get(ctx, path, url.Values{"page": {strconv.Itoa(page)}}, &v); err != nil {
+		return CatalogPage{}, fmt.Errorf("couldn't get %v %v catalog: %v", kind, typ, err)
+	}
+
+	mediaType := "movie"
+	if typ == "series" {
+		mediaType = "tv"
+	}
+
+	catalog := CatalogPage{Page: page, HasMore: v.Page < v.TotalPages}
+	for _, r := range v.Results {
+		imdbID, err := t.imdbID(ctx, mediaType, r.ID)
+		if err != nil {
+			return CatalogPage{}, err
+		}
+		if imdbID == "" {
+			continue
+		}
+		title, date := r.Title, r.ReleaseDate
+		if typ == "series" {
+			title, date = r.Name, r.FirstAirDate
+		}
+		catalog.Items = append(catalog.Items, CatalogItem{
+			Meta: Meta{IMDbID: imdbID, Title: title, Year: yearOf(date)},
+			Type: typ,
+		})
+	}
+
+	return catalog, nil
+}
+
+// Cinemeta is a client for the catalogs of Stremio's Cinemeta addon, which
+// are keyed by IMDb ID and need no API key.
+type Cinemeta struct {
+	opts Options
+}
+
+var DefaultCinemetaOptions = Options{
+	Timeout: 10 * time.Second,
+	URL:     "https://v3-cinemeta.strem.io",
+}
+
+// cinemetaPageSize is the number of titles Cinemeta returns per request.
+const cinemetaPageSize = 100
+
+func NewCinemeta(opts Options) *Cinemeta {
+	return &Cinemeta{opts: opts}
+}
+
+var cinemetaCatalogs = map[CatalogKind]string{
+	CatalogPopular: "top",
+	CatalogNew:     "year",
+}
+
+// GetCatalog returns a page of a Cinemeta catalog. Cinemeta has no
+// trending catalog.
+func (c *Cinemeta) GetCatalog(ctx context.Context, kind CatalogKind, typ string, page int) (CatalogPage, error) {
+	id, ok := cinemetaCatalogs[kind]
+	if !ok || (typ != "movie" && typ != "series") {
+		return CatalogPage{}, fmt.Errorf("%w: %v %v", ErrUnsupportedCatalog, kind, typ)
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	URL := strings.TrimSuffix(c.opts.URL, "/") + "/catalog/" + typ + "/" + id
+	if skip := (page - 1) * cinemetaPageSize; skip > 0 {
+		URL += "/skip=" + strconv.Itoa(skip)
+	}
+	URL += ".json"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return CatalogPage{}, err
+	}
+
+	transport := c.opts.Transport
+	if transport == nil {
+		transport = defaultTransport
+	}
+
+	client := &http.Client{Timeout: c.opts.Timeout, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return CatalogPage{}, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return CatalogPage{}, fmt.Errorf("got http error %q", resp.Status)
+	}
+
+	var v struct {
+		Metas []struct {
+			IMDbID      string `json:"imdb_id"`
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			ReleaseInfo string `json:"releaseInfo"`
+		} `json:"metas"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return CatalogPage{}, fmt.Errorf("couldn't decode %v %v catalog: %v", kind, typ, err)
+	}
+
+	catalog := CatalogPage{Page: page, HasMore: len(v.Metas) >= cinemetaPageSize}
+	for _, m := range v.Metas {
+		imdbID := m.IMDbID
+		if imdbID == "" && strings.HasPrefix(m.ID, "tt") {
+			imdbID = m.ID
+		}
+		if imdbID == "" {
+			continue
+		}
+		year, _ := strconv.Atoi(strings.Split(m.ReleaseInfo, "–")[0])
+		catalog.Items = append(catalog.Items, CatalogItem{
+			Meta: Meta{IMDbID: imdbID, Title: m.Name, Year: year},
+			Type: typ,
+		})
+	}
+
+	return catalog, nil
+}
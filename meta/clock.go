@@ -0,0 +1,23 @@
+package meta
+
+import "time"
+
+// Clock is the time source of cache ages and quota days. Every
+// torrent.Clock, like torrenttest.FakeClock, is one.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockOr returns c, or the system clock if c is nil.
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return c
+}
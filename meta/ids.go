@@ -0,0 +1,336 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDKind is the database an ID belongs to. TMDB IDs are only unique per
+// media type, so movies and series have their own kinds.
+type IDKind string
+
+const (
+	IDIMDb       IDKind = "imdb"
+	IDTMDBMovie  IDKind = "tmdb-movie"
+	IDTMDBSeries IDKind = "tmdb-series"
+	IDTVDB       IDKind = "tvdb"
+	IDKitsu      IDKind = "kitsu"
+)
+
+// ExternalIDs are the IDs of one title across databases, 0 or "" where
+// unknown. Type is "movie" or "series".
+type ExternalIDs struct {
+	Type  string `json:"type,omitempty"`
+	IMDb  string `json:"imdb,omitempty"`
+	TMDB  int    `json:"tmdb,omitempty"`
+	TVDB  int    `json:"tvdb,omitempty"`
+	Kitsu int    `json:"kitsu,omitempty"`
+}
+
+type TranslatorOptions struct {
+	// KitsuURL is the Kitsu API, which maps anime to TVDB.
+	KitsuURL string
+	Timeout  time.Duration
+	// Parallelism is the number of IDs translated at the same time where
+	// the upstream has no batch lookup.
+	Parallelism int
+	CacheAge    time.Duration
+
+	// Clock is the time source of cache ages, the system clock if nil.
+	Clock Clock
+}
+
+var DefaultTranslatorOpts = TranslatorOptions{
+	KitsuURL:    "https://kitsu.io/api/edge",
+	Timeout:     10 * time.Second,
+	Parallelism: 4,
+	CacheAge:    7 * 24 * time.Hour,
+}
+
+// kitsuBatchSize is the page limit of the Kitsu API.
+const kitsuBatchSize = 20
+
+type cachedIDs struct {
+	ids     ExternalIDs
+	fetched time.Time
+}
+
+// IDTranslator translates IDs between IMDb, TMDB, TVDB and Kitsu in bulk.
+// Translations are cached, since per-ID lookups dominate the time of large
+// library scans. Kitsu IDs are looked up 20 per request; Kitsu can't be
+// searched by other IDs, so it's only a source.
+type IDTranslator struct {
+	opts   TranslatorOptions
+	tmdb   *TMDB
+	client *http.Client
+	cache  map[string]cachedIDs
+	clock  Clock
+	lock   *sync.Mutex
+}
+
+func NewIDTranslator(opts TranslatorOptions, tmdb *TMDB) *IDTranslator {
+	return &IDTranslator{
+		opts:   opts,
+		tmdb:   tmdb,
+		client: &http.Client{Timeout: opts.Timeout, Transport: defaultTransport},
+		cache:  map[string]cachedIDs{},
+		clock:  clockOr(opts.Clock),
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Translate returns the external IDs of every ID of kind, keyed by the
+// given IDs. IDs that can't be found are left out.
+func (t *IDTranslator) Translate(ctx context.Context, kind IDKind, ids []string) (map[string]ExternalIDs, error) {
+	translated := map[string]ExternalIDs{}
+	var missing []string
+	for _, id := range ids {
+		if cached, ok := t.cached(kind, id); ok {
+			translated[id] = cached
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	var fetched map[string]ExternalIDs
+	var err error
+	switch kind {
+	case IDKitsu:
+		fetched, err = t.fromKitsu(ctx, missing)
+	case IDIMDb, IDTMDBMovie, IDTMDBSeries, IDTVDB:
+		fetched, err = t.each(ctx, missing, func(ctx context.Context, id string) (ExternalIDs, error) {
+			return t.fromTMDB(ctx, kind, id)
+		})
+	default:
+		return nil, fmt.Errorf("unknown ID kind %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for id, ids := range fetched {
+		t.store(kind, id, ids)
+		translated[id] = ids
+	}
+	return translated, nil
+}
+
+func (t *IDTranslator) cached(kind IDKind, id string) (ExternalIDs, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c, ok := t.cache[string(kind)+":"+id]
+	if !ok || t.clock.Now().Sub(c.fetched) > t.opts.CacheAge {
+		return ExternalIDs{}, false
+	}
+	return c.ids, true
+}
+
+func (t *IDTranslator) store(kind IDKind, id string, ids ExternalIDs) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.cache[string(kind)+":"+id] = cachedIDs{ids: ids, fetched: t.clock.Now()}
+}
+
+// each translates ids one by one, Parallelism at a time.
+func (t *IDTranslator) each(ctx context.Context, ids []string, translate func(context.Context, string) (ExternalIDs, error)) (map[string]ExternalIDs, error) {
+	parallelism := t.opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]ExternalIDs, len(ids))
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = translate(ctx, id)
+		}(i, id)
+	}
+	wg.Wait()
+
+	translated := map[string]ExternalIDs{}
+	for i, id := range ids {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if results[i] != (ExternalIDs{}) {
+			translated[id] = results[i]
+		}
+	}
+	return translated, nil
+}
+
+func (t *IDTranslator) fromTMDB(ctx context.Context, kind IDKind, id string) (ExternalIDs, error) {
+	ids := ExternalIDs{}
+	switch kind {
+	case IDTMDBMovie, IDTMDBSeries:
+		tmdbID, err := strconv.Atoi(id)
+		if err != nil {
+			return ExternalIDs{}, fmt.Errorf("invalid TMDB ID %q", id)
+		}
+		ids.TMDB, ids.Type = tmdbID, "movie"
+		if kind == IDTMDBSeries {
+			ids.Type = "series"
+		}
+	default:
+		source := "imdb_id"
+		if kind == IDTVDB {
+			source = "tvdb_id"
+		}
+		var v struct {
+			MovieResults []struct {
+				ID int `json:"id"`
+			} `json:"movie_results"`
+			TVResults []struct {
+				ID int `json:"id"`
+			} `json:"tv_results"`
+		}
+		if err := t.tmdb.get(ctx, "/find/"+url.PathEscape(id), url.Values{"external_source": {source}}, &v); err != nil {
+			return ExternalIDs{}, fmt.Errorf("couldn't find %v %v on TMDB: %v", kind, id, err)
+		}
+		switch {
+		case len(v.MovieResults) > 0:
+			ids.TMDB, ids.Type = v.MovieResults[0].ID, "movie"
+		case len(v.TVResults) > 0:
+			ids.TMDB, ids.Type = v.TVResults[0].ID, "series"
+		default:
+			return ExternalIDs{}, nil
+		}
+	}
+
+	mediaType := "movie"
+	if ids.Type == "series" {
+		mediaType = "tv"
+	}
+	var v struct {
+		IMDbID string `json:"imdb_id"`
+		TVDBID int    `json:"tvdb_id"`
+	}
+	if err := t.tmdb.get(ctx, "/"+mediaType+"/"+strconv.Itoa(ids.TMDB)+"/external_ids", nil, &v); err != nil {
+		return ExternalIDs{}, fmt.Errorf("couldn't get external IDs of TMDB %v %v: %v", mediaType, ids.TMDB, err)
+	}
+	ids.IMDb, ids.TVDB = v.IMDbID, v.TVDBID
+	return ids, nil
+}
+
+// fromKitsu maps Kitsu anime to TVDB in batches, then completes the IDs
+// through TMDB.
+func (t *IDTranslator) fromKitsu(ctx context.Context, ids []string) (map[string]ExternalIDs, error) {
+	tvdb := map[string]string{}
+	for start := 0; start < len(ids); start += kitsuBatchSize {
+		end := start + kitsuBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, err := t.kitsuMappings(ctx, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for id, tvdbID := range batch {
+			tvdb[id] = tvdbID
+		}
+	}
+
+	var tvdbIDs []string
+	for _, tvdbID := range tvdb {
+		tvdbIDs = append(tvdbIDs, tvdbID)
+	}
+	fromTVDB, err := t.Translate(ctx, IDTVDB, tvdbIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	translated := map[string]ExternalIDs{}
+	for id, tvdbID := range tvdb {
+		ids := fromTVDB[tvdbID]
+		ids.Kitsu, _ = strconv.Atoi(id)
+		if ids.TVDB == 0 {
+			ids.TVDB, _ = strconv.Atoi(tvdbID)
+		}
+		translated[id] = ids
+	}
+	return translated, nil
+}
+
+// kitsuMappings returns the TVDB series IDs of up to kitsuBatchSize Kitsu
+// anime with a single request.
+func (t *IDTranslator) kitsuMappings(ctx context.Context, ids []string) (map[string]string, error) {
+	params := url.Values{
+		"filter[id]":  {strings.Join(ids, ",")},
+		"include":     {"mappings"},
+		"page[limit]": {strconv.Itoa(kitsuBatchSize)},
+	}
+	URL := strings.TrimSuffix(t.opts.KitsuURL, "/") + "/anime?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get Kitsu mappings: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got http error %q", resp.Status)
+	}
+
+	type relationship struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	var v struct {
+		Data []struct {
+			ID            string `json:"id"`
+			Relationships struct {
+				Mappings relationship `json:"mappings"`
+			} `json:"relationships"`
+		} `json:"data"`
+		Included []struct {
+			ID         string `json:"id"`
+			Type       string `json:"type"`
+			Attributes struct {
+				ExternalSite string `json:"externalSite"`
+				ExternalID   string `json:"externalId"`
+			} `json:"attributes"`
+		} `json:"included"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("couldn't decode Kitsu mappings: %v", err)
+	}
+
+	tvdbByMapping := map[string]string{}
+	for _, inc := range v.Included {
+		if inc.Type == "mappings" && strings.HasPrefix(inc.Attributes.ExternalSite, "thetvdb") {
+			// Season mappings look like "81797/2", the series is before the slash.
+			tvdbByMapping[inc.ID] = strings.Split(inc.Attributes.ExternalID, "/")[0]
+		}
+	}
+
+	tvdb := map[string]string{}
+	for _, anime := range v.Data {
+		for _, m := range anime.Relationships.Mappings.Data {
+			if id, ok := tvdbByMapping[m.ID]; ok {
+				tvdb[anime.ID] = id
+				break
+			}
+		}
+	}
+	return tvdb, nil
+}
@@ -3,24 +3,59 @@ package meta
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/jelliflix/imdb/credentials"
 )
 
 type OMDB struct {
 	apiKey string
 	opts   Options
+	quota  *quota
+
+	// seasons are the last fetched episodes per season, served when the
+	// quota is exhausted.
+	seasons     map[string][]Meta
+	seasonsLock *sync.Mutex
 }
 
 type Options struct {
 	URL string
 
 	Timeout time.Duration
+
+	// Transport defaults to http.DefaultTransport, or to the Fetch API
+	// when compiled to WebAssembly for browsers.
+	Transport http.RoundTripper
+
+	// Credentials resolves the API key before every request, overriding
+	// the key passed to the constructor. The OMDB key is named "omdb",
+	// the TMDB key "tmdb".
+	Credentials credentials.Store
+
+	// SearchThreshold is the confidence Search needs to pick a candidate,
+	// 0 for DefaultSearchThreshold.
+	SearchThreshold float64
+
+	// DailyQuota is the number of OMDB requests the API key may make per
+	// day, like 1000 for free keys, 0 if unknown. Requests are counted per
+	// client and the count resets at midnight UTC.
+	DailyQuota int
+
+	// SeasonParallelism is the number of seasons GetSeasons fetches at the
+	// same time.
+	SeasonParallelism int
+
+	// Clock is the time source of the quota day, the system clock if nil.
+	Clock Clock
 }
 
 type Meta struct {
@@ -30,25 +65,58 @@ type Meta struct {
 	Year     int
 
 	Title string
+
+	// IMDbID is the ID of the movie or episode itself.
+	IMDbID string
+
+	// Rating is the IMDb rating from 0 to 10, Votes the number of IMDb
+	// votes and Metascore the Metacritic score from 0 to 100. They are 0
+	// when OMDB has no value ("N/A").
+	Rating    float64
+	Votes     int
+	Metascore int
+
+	// Countries are the production countries by name, like "United
+	// States".
+	Countries []string
+
+	// Released is the release or air date, zero if unknown.
+	Released time.Time
 }
 
 func NewOMDB(opts Options, apiKey string) *OMDB {
-	return &OMDB{opts: opts, apiKey: apiKey}
+	return &OMDB{
+		opts:        opts,
+		apiKey:      apiKey,
+		quota:       &quota{limit: opts.DailyQuota, clock: clockOr(opts.Clock), lock: &sync.Mutex{}},
+		seasons:     map[string][]Meta{},
+		seasonsLock: &sync.Mutex{},
+	}
 }
 
 var DefaultOptions = Options{
 	Timeout: 10 * time.Second,
 	URL:     "https://www.omdbapi.com/",
+
+	SearchThreshold:   DefaultSearchThreshold,
+	SeasonParallelism: 4,
 }
 
 func (m *Meta) UnmarshalJSON(data []byte) error {
 	var v struct {
+		IMDbID   string `json:"imdbID"`
 		SeriesID string `json:"seriesID,required"`
 		Episode  string `json:"Episode,required"`
 		Season   string `json:"Season,required"`
 		Year     string `json:"Year,required"`
 
 		Title string `json:"Title,required"`
+
+		Rating    string `json:"imdbRating"`
+		Votes     string `json:"imdbVotes"`
+		Metascore string `json:"Metascore"`
+		Country   string `json:"Country"`
+		Released  string `json:"Released"`
 	}
 
 	if err := json.Unmarshal(data, &v); err != nil {
@@ -61,49 +129,101 @@ func (m *Meta) UnmarshalJSON(data []byte) error {
 
 	// Sometimes api only contains one `t` on series id.
 	series := []rune(v.SeriesID)
-	if len(series) > 0 && string(series[1]) != "t" {
+	if len(series) > 1 && string(series[1]) != "t" {
 		m.SeriesID = "t" + v.SeriesID
 	} else {
 		m.SeriesID = v.SeriesID
 	}
 
+	m.IMDbID = v.IMDbID
 	m.Episode = int(episode)
 	m.Season = int(season)
 	m.Year = int(year)
 
 	m.Title = v.Title
 
+	m.Rating, _ = strconv.ParseFloat(notAvailable(v.Rating), 64)
+	m.Votes, _ = strconv.Atoi(strings.ReplaceAll(notAvailable(v.Votes), ",", ""))
+	m.Metascore, _ = strconv.Atoi(notAvailable(v.Metascore))
+	m.Countries = nil
+	if country := notAvailable(v.Country); country != "" {
+		for _, c := range strings.Split(country, ",") {
+			m.Countries = append(m.Countries, strings.TrimSpace(c))
+		}
+	}
+	m.Released = time.Time{}
+	// Full records have "20 Jan 2008", season listings "2008-01-20".
+	for _, layout := range []string{"02 Jan 2006", "2006-01-02"} {
+		if released, err := time.Parse(layout, notAvailable(v.Released)); err == nil {
+			m.Released = released
+			break
+		}
+	}
+
 	return nil
 }
 
-func (o *OMDB) request(params url.Values) (reader io.ReadCloser, err error) {
+// notAvailable maps OMDB's "N/A" placeholder to an empty string, which
+// doesn't parse and so leaves numeric fields at 0.
+func notAvailable(s string) string {
+	if s = strings.TrimSpace(s); s == "N/A" {
+		return ""
+	}
+	return s
+}
+
+func (o *OMDB) request(ctx context.Context, params url.Values) (reader io.ReadCloser, err error) {
 	URL, err := url.Parse(o.opts.URL)
 	if err != nil {
 		return
 	}
 
+	apiKey, err := credentials.Resolve(ctx, o.opts.Credentials, "omdb", o.apiKey)
+	if err != nil {
+		return
+	}
+	params.Set("apikey", apiKey)
 	URL.RawQuery = params.Encode()
 
-	c := &http.Client{Timeout: o.opts.Timeout}
-	resp, err := c.Get(URL.String())
+	req, err := http.NewRequestWithContext(ctx, "GET", URL.String(), nil)
 	if err != nil {
 		return
 	}
 
+	if !o.quota.take() {
+		return reader, ErrQuotaExceeded
+	}
+
+	transport := o.opts.Transport
+	if transport == nil {
+		transport = defaultTransport
+	}
+
+	c := &http.Client{Timeout: o.opts.Timeout, Transport: transport}
+	resp, err := c.Do(req)
+	if err != nil {
+		return reader, fmt.Errorf("couldn't GET %v: %v", credentials.RedactURL(URL.String()), errors.Unwrap(err))
+	}
+
 	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		if strings.Contains(string(body), "limit reached") {
+			o.quota.exhaust()
+			return reader, ErrQuotaExceeded
+		}
 		return reader, fmt.Errorf("got http error %q", resp.Status)
 	}
 
 	return resp.Body, err
 }
 
-func (o *OMDB) reqMeta(kind, id string) (meta Meta, err error) {
+func (o *OMDB) reqMeta(ctx context.Context, kind, id string) (meta Meta, err error) {
 	params := url.Values{}
 	params.Add("i", id)
 	params.Add("type", kind)
-	params.Add("apikey", o.apiKey)
 
-	resp, err := o.request(params)
+	resp, err := o.request(ctx, params)
 	if err != nil {
 		return
 	}
@@ -121,18 +241,72 @@ func (o *OMDB) reqMeta(kind, id string) (meta Meta, err error) {
 	return
 }
 
-func (o *OMDB) GetMovie(_ context.Context, id string) (Meta, error) {
-	meta, err := o.reqMeta("movie", id)
+func (o *OMDB) GetMovie(ctx context.Context, id string) (Meta, error) {
+	meta, err := o.reqMeta(ctx, "movie", id)
 	return meta, err
 }
 
-func (o *OMDB) GetEpisode(_ context.Context, id string) (Meta, error) {
-	meta, err := o.reqMeta("episode", id)
+func (o *OMDB) GetEpisode(ctx context.Context, id string) (Meta, error) {
+	meta, err := o.reqMeta(ctx, "episode", id)
 	return meta, err
 }
 
 func (o *OMDB) GetSeriesByEpisode(ctx context.Context, id string) (Meta, error) {
 	episode, err := o.GetEpisode(ctx, id)
-	meta, err := o.reqMeta("series", episode.SeriesID)
+	meta, err := o.reqMeta(ctx, "series", episode.SeriesID)
 	return meta, err
 }
+
+// GetSeason returns the episodes of a season. Once the quota is exhausted,
+// the episodes of the last fetch are returned, if any.
+func (o *OMDB) GetSeason(ctx context.Context, seriesID string, season int) ([]Meta, error) {
+	episodes, err := o.getSeason(ctx, seriesID, season)
+	key := seriesID + ":" + strconv.Itoa(season)
+	o.seasonsLock.Lock()
+	defer o.seasonsLock.Unlock()
+	if errors.Is(err, ErrQuotaExceeded) {
+		if cached, ok := o.seasons[key]; ok {
+			return cached, nil
+		}
+	} else if err == nil {
+		o.seasons[key] = episodes
+	}
+	return episodes, err
+}
+
+func (o *OMDB) getSeason(ctx context.Context, seriesID string, season int) ([]Meta, error) {
+	params := url.Values{}
+	params.Add("i", seriesID)
+	params.Add("Season", strconv.Itoa(season))
+
+	resp, err := o.request(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Close()
+	}()
+
+	var v struct {
+		Response string `json:"Response"`
+		Error    string `json:"Error"`
+		Episodes []Meta `json:"Episodes"`
+	}
+	if err = json.NewDecoder(resp).Decode(&v); err != nil {
+		return nil, err
+	}
+	if v.Response == "False" && strings.Contains(v.Error, "limit reached") {
+		o.quota.exhaust()
+		return nil, ErrQuotaExceeded
+	} else if v.Response == "False" {
+		return nil, fmt.Errorf("couldn't get season %v of %v: %v", season, seriesID, v.Error)
+	}
+
+	for i := range v.Episodes {
+		v.Episodes[i].SeriesID = seriesID
+		v.Episodes[i].Season = season
+	}
+
+	return v.Episodes, nil
+}
@@ -0,0 +1,129 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Role selects which credits of a person are listed.
+type Role string
+
+const (
+	RoleActor    Role = "actor"
+	RoleDirector Role = "director"
+)
+
+// Person is a cast or crew member. IMDbID is a name ID like "nm0000148".
+type Person struct {
+	IMDbID string
+	Name   string
+}
+
+// Credit is a title a person worked on. Type is "movie" or "series" and
+// Character or Job describes what the person did.
+type Credit struct {
+	Meta
+	Type      string
+	Character string
+	Job       string
+}
+
+// SearchPerson returns the most popular person matching name.
+func (t *TMDB) SearchPerson(ctx context.Context, name string) (Person, error) {
+	var v struct {
+		Results []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+	if err := t.get(ctx, "/search/person", url.Values{"query": {name}}, &v); err != nil {
+		return Person{}, fmt.Errorf("couldn't search person %q: %v", name, err)
+	}
+	if len(v.Results) == 0 {
+		return Person{}, fmt.Errorf("couldn't find person %q", name)
+	}
+
+	id, err := t.imdbID(ctx, "person", v.Results[0].ID)
+	if err != nil {
+		return Person{}, err
+	}
+	return Person{IMDbID: id, Name: v.Results[0].Name}, nil
+}
+
+// GetCredits lists the titles a person acted in or directed, by IMDb name
+// ID, ordered by release date. Titles without an IMDb ID are left out.
+func (t *TMDB) GetCredits(ctx context.Context, personID string, role Role) ([]Credit, error) {
+	id, err := t.tmdbID(ctx, personID, "person")
+	if err != nil {
+		return nil, err
+	}
+
+	type credit struct {
+		ID           int    `json:"id"`
+		MediaType    string `json:"media_type"`
+		Title        string `json:"title"`
+		Name         string `json:"name"`
+		ReleaseDate  string `json:"release_date"`
+		FirstAirDate string `json:"first_air_date"`
+		Character    string `json:"character"`
+		Job          string `json:"job"`
+	}
+	var v struct {
+		Cast []credit `json:"cast"`
+		Crew []credit `json:"crew"`
+	}
+	if err = t.get(ctx, "/person/"+strconv.Itoa(id)+"/combined_credits", nil, &v); err != nil {
+		return nil, fmt.Errorf("couldn't get credits of %v: %v", personID, err)
+	}
+
+	var credits []credit
+	switch role {
+	case RoleActor:
+		credits = v.Cast
+	case RoleDirector:
+		for _, c := range v.Crew {
+			if c.Job == "Director" {
+				credits = append(credits, c)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	seen := map[string]bool{}
+	var result []Credit
+	for _, c := range credits {
+		kind, title, date := "movie", c.Title, c.ReleaseDate
+		if c.MediaType == "tv" {
+			kind, title, date = "series", c.Name, c.FirstAirDate
+		}
+
+		imdbID, err := t.imdbID(ctx, c.MediaType, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		// Series directors are credited once per episode.
+		if imdbID == "" || seen[imdbID] {
+			continue
+		}
+		seen[imdbID] = true
+
+		result = append(result, Credit{
+			Meta:      Meta{IMDbID: imdbID, Title: title, Year: yearOf(date)},
+			Type:      kind,
+			Character: c.Character,
+			Job:       c.Job,
+		})
+	}
+
+	// Unreleased titles have no year yet and go last.
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].Year, result[j].Year
+		return b == 0 && a != 0 || a != 0 && a < b
+	})
+
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when the daily request quota of the OMDB key
+// is used up, either by the count against Options.DailyQuota or because
+// OMDB said so.
+var ErrQuotaExceeded = errors.New("daily request quota exceeded")
+
+// quota counts the requests of a day. A limit of 0 is unknown, so only
+// OMDB reporting the limit stops requests.
+type quota struct {
+	limit     int
+	day       string
+	used      int
+	exhausted bool
+	clock     Clock
+	lock      *sync.Mutex
+}
+
+// reset starts a new count at midnight UTC. Callers hold the lock.
+func (q *quota) reset() {
+	if day := q.clock.Now().UTC().Format("2006-01-02"); day != q.day {
+		q.day, q.used, q.exhausted = day, 0, false
+	}
+}
+
+// take reserves one request, reporting false if the quota is used up.
+func (q *quota) take() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.reset()
+	if q.exhausted || q.limit > 0 && q.used >= q.limit {
+		return false
+	}
+	q.used++
+	return true
+}
+
+func (q *quota) exhaust() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.reset()
+	q.exhausted = true
+}
+
+func (q *quota) remaining() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.reset()
+	switch {
+	case q.exhausted:
+		return 0
+	case q.limit <= 0:
+		return -1
+	case q.used >= q.limit:
+		return 0
+	}
+	return q.limit - q.used
+}
+
+// Remaining returns the number of requests left today, or -1 if
+// Options.DailyQuota is unknown and OMDB hasn't reported the limit yet.
+func (o *OMDB) Remaining() int {
+	return o.quota.remaining()
+}
+
+// GetSeasons fetches seasons SeasonParallelism at a time, keyed by season.
+// Seasons beyond the remaining quota come from earlier fetches where
+// possible; the others are left out and ErrQuotaExceeded is returned along
+// with the seasons that could be fetched.
+func (o *OMDB) GetSeasons(ctx context.Context, seriesID string, seasons []int) (map[int][]Meta, error) {
+	parallelism := o.opts.SeasonParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([][]Meta, len(seasons))
+	errs := make([]error, len(seasons))
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	for i, season := range seasons {
+		wg.Add(1)
+		go func(i, season int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = o.GetSeason(ctx, seriesID, season)
+		}(i, season)
+	}
+	wg.Wait()
+
+	fetched := map[int][]Meta{}
+	var missing []int
+	for i, season := range seasons {
+		if errors.Is(errs[i], ErrQuotaExceeded) {
+			missing = append(missing, season)
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		fetched[season] = results[i]
+	}
+	if len(missing) > 0 {
+		return fetched, fmt.Errorf("couldn't get seasons %v of %v: %w", missing, seriesID, ErrQuotaExceeded)
+	}
+	return fetched, nil
+}
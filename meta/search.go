@@ -0,0 +1,193 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jelliflix/imdb/parse"
+)
+
+// ErrAmbiguous is returned by searches where no candidate is a confident
+// match, so that callers can ask instead of picking the wrong title.
+var ErrAmbiguous = errors.New("ambiguous search result")
+
+// DefaultSearchThreshold is the confidence a candidate needs to be picked.
+const DefaultSearchThreshold = 0.6
+
+// Candidates closer than this to the best one make a search ambiguous.
+const searchTieMargin = 0.05
+
+// Query is a title search. Year and Type ("movie", "series" or "episode")
+// are optional but improve disambiguation.
+type Query struct {
+	Title string
+	Year  int
+	Type  string
+}
+
+// Candidate is one result of a title search. Popularity is provider
+// specific and only compared between candidates of the same search.
+type Candidate struct {
+	IMDbID     string
+	Title      string
+	Year       int
+	Type       string
+	Popularity float64
+
+	// Score is the confidence from 0 to 1 that the candidate is the
+	// searched title.
+	Score float64
+}
+
+// ScoreCandidates scores candidates against q by title similarity, year
+// proximity, type match and popularity, and sorts them from best to worst.
+func ScoreCandidates(q Query, candidates []Candidate) {
+	maxPopularity := 0.0
+	for _, c := range candidates {
+		maxPopularity = math.Max(maxPopularity, c.Popularity)
+	}
+
+	for i, c := range candidates {
+		popularity := 0.0
+		if maxPopularity > 0 {
+			popularity = c.Popularity / maxPopularity
+		}
+		candidates[i].Score = 0.5*titleSimilarity(q.Title, c.Title) +
+			0.25*yearProximity(q.Year, c.Year) +
+			0.15*typeMatch(q.Type, c.Type) +
+			0.1*popularity
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
+
+// Disambiguate picks the best candidate for q. It returns ErrAmbiguous if
+// the best candidate scores below threshold or another one ties with it.
+func Disambiguate(q Query, candidates []Candidate, threshold float64) (Candidate, error) {
+	if len(candidates) == 0 {
+		return Candidate{}, fmt.Errorf("couldn't find %q", q.Title)
+	}
+
+	ScoreCandidates(q, candidates)
+	best := candidates[0]
+	if best.Score < threshold {
+		return best, fmt.Errorf("%w: best match for %q is %q (%v) with confidence %.2f", ErrAmbiguous, q.Title, best.Title, best.Year, best.Score)
+	}
+	if len(candidates) > 1 && best.Score-candidates[1].Score < searchTieMargin {
+		return best, fmt.Errorf("%w: %q matches both %v and %v", ErrAmbiguous, q.Title, best.IMDbID, candidates[1].IMDbID)
+	}
+
+	return best, nil
+}
+
+// Search looks up a title and returns the most likely candidate, or
+// ErrAmbiguous together with the best guess if no candidate is confident
+// enough.
+func (o *OMDB) Search(ctx context.Context, q Query) (Candidate, error) {
+	params := url.Values{}
+	params.Add("s", q.Title)
+	if q.Type != "" {
+		params.Add("type", q.Type)
+	}
+
+	resp, err := o.request(ctx, params)
+	if err != nil {
+		return Candidate{}, err
+	}
+
+	defer func() {
+		_ = resp.Close()
+	}()
+
+	var v struct {
+		Response string `json:"Response"`
+		Error    string `json:"Error"`
+		Search   []struct {
+			IMDbID string `json:"imdbID"`
+			Title  string `json:"Title"`
+			Year   string `json:"Year"`
+			Type   string `json:"Type"`
+		} `json:"Search"`
+	}
+	if err = json.NewDecoder(resp).Decode(&v); err != nil {
+		return Candidate{}, err
+	}
+	if v.Response == "False" {
+		return Candidate{}, fmt.Errorf("couldn't search %q: %v", q.Title, v.Error)
+	}
+
+	candidates := make([]Candidate, 0, len(v.Search))
+	for i, s := range v.Search {
+		year, _ := strconv.Atoi(strings.Split(s.Year, "–")[0])
+		candidates = append(candidates, Candidate{
+			IMDbID: s.IMDbID,
+			Title:  s.Title,
+			Year:   year,
+			Type:   s.Type,
+			// OMDB orders by relevance but has no popularity, so the
+			// position stands in for it.
+			Popularity: float64(len(v.Search) - i),
+		})
+	}
+
+	threshold := o.opts.SearchThreshold
+	if threshold == 0 {
+		threshold = DefaultSearchThreshold
+	}
+	return Disambiguate(q, candidates, threshold)
+}
+
+// titleSimilarity is the Dice coefficient of the normalized title words.
+func titleSimilarity(a, b string) float64 {
+	a, b = parse.NormalizeTitle(a), parse.NormalizeTitle(b)
+	if a == b {
+		return 1
+	}
+
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	counts := map[string]int{}
+	for _, w := range wordsA {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range wordsB {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wordsA)+len(wordsB))
+}
+
+// yearProximity tolerates off-by-one years, which are common between
+// festival and theatrical releases.
+func yearProximity(want, got int) float64 {
+	switch {
+	case want == 0:
+		return 1
+	case want == got:
+		return 1
+	case want-got == 1 || got-want == 1:
+		return 0.5
+	}
+	return 0
+}
+
+func typeMatch(want, got string) float64 {
+	if want == "" || strings.EqualFold(want, got) {
+		return 1
+	}
+	return 0
+}
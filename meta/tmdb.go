@@ -0,0 +1,183 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+)
+
+// TMDB is a client for The Movie Database, which knows relations between
+// titles that OMDB doesn't, like collections.
+type TMDB struct {
+	apiKey string
+	opts   Options
+}
+
+var DefaultTMDBOptions = Options{
+	Timeout: 10 * time.Second,
+	URL:     "https://api.themoviedb.org/3",
+
+	SearchThreshold: DefaultSearchThreshold,
+}
+
+func NewTMDB(opts Options, apiKey string) *TMDB {
+	return &TMDB{opts: opts, apiKey: apiKey}
+}
+
+// Collection is a franchise like "James Bond Collection". Movies are ordered
+// by release date and only include those with an IMDb ID.
+type Collection struct {
+	Name   string
+	Movies []Meta
+}
+
+func (t *TMDB) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	URL, err := url.Parse(strings.TrimSuffix(t.opts.URL, "/") + path)
+	if err != nil {
+		return err
+	}
+
+	apiKey, err := credentials.Resolve(ctx, t.opts.Credentials, "tmdb", t.apiKey)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api_key", apiKey)
+	URL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", URL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	transport := t.opts.Transport
+	if transport == nil {
+		transport = defaultTransport
+	}
+
+	c := &http.Client{Timeout: t.opts.Timeout, Transport: transport}
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't GET %v: %v", credentials.RedactURL(URL.String()), errors.Unwrap(err))
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got http error %q", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// tmdbID maps an IMDb ID to the TMDB ID of a movie, tv show or person.
+func (t *TMDB) tmdbID(ctx context.Context, imdbID, kind string) (int, error) {
+	var v struct {
+		MovieResults []struct {
+			ID int `json:"id"`
+		} `json:"movie_results"`
+		TVResults []struct {
+			ID int `json:"id"`
+		} `json:"tv_results"`
+		PersonResults []struct {
+			ID int `json:"id"`
+		} `json:"person_results"`
+	}
+	params := url.Values{"external_source": {"imdb_id"}}
+	if err := t.get(ctx, "/find/"+imdbID, params, &v); err != nil {
+		return 0, fmt.Errorf("couldn't find %v on TMDB: %v", imdbID, err)
+	}
+
+	switch {
+	case kind == "movie" && len(v.MovieResults) > 0:
+		return v.MovieResults[0].ID, nil
+	case kind == "tv" && len(v.TVResults) > 0:
+		return v.TVResults[0].ID, nil
+	case kind == "person" && len(v.PersonResults) > 0:
+		return v.PersonResults[0].ID, nil
+	}
+	return 0, fmt.Errorf("couldn't find %v %v on TMDB", kind, imdbID)
+}
+
+// imdbID maps the TMDB ID of a movie, tv show or person to its IMDb ID.
+func (t *TMDB) imdbID(ctx context.Context, kind string, id int) (string, error) {
+	var v struct {
+		IMDbID string `json:"imdb_id"`
+	}
+	if err := t.get(ctx, "/"+kind+"/"+strconv.Itoa(id)+"/external_ids", nil, &v); err != nil {
+		return "", fmt.Errorf("couldn't get external IDs of TMDB %v %v: %v", kind, id, err)
+	}
+	return v.IMDbID, nil
+}
+
+// GetCollection returns the collection a movie belongs to, including the
+// movie itself.
+func (t *TMDB) GetCollection(ctx context.Context, imdbID string) (Collection, error) {
+	id, err := t.tmdbID(ctx, imdbID, "movie")
+	if err != nil {
+		return Collection{}, err
+	}
+
+	var movie struct {
+		Collection *struct {
+			ID int `json:"id"`
+		} `json:"belongs_to_collection"`
+	}
+	if err = t.get(ctx, "/movie/"+strconv.Itoa(id), nil, &movie); err != nil {
+		return Collection{}, fmt.Errorf("couldn't get TMDB movie %v: %v", id, err)
+	}
+	if movie.Collection == nil {
+		return Collection{}, fmt.Errorf("movie %v doesn't belong to a collection", imdbID)
+	}
+
+	var collection struct {
+		Name  string `json:"name"`
+		Parts []struct {
+			ID          int    `json:"id"`
+			Title       string `json:"title"`
+			ReleaseDate string `json:"release_date"`
+		} `json:"parts"`
+	}
+	if err = t.get(ctx, "/collection/"+strconv.Itoa(movie.Collection.ID), nil, &collection); err != nil {
+		return Collection{}, fmt.Errorf("couldn't get TMDB collection %v: %v", movie.Collection.ID, err)
+	}
+
+	// Unreleased parts have no date yet and go last.
+	sort.SliceStable(collection.Parts, func(i, j int) bool {
+		a, b := collection.Parts[i].ReleaseDate, collection.Parts[j].ReleaseDate
+		return b == "" && a != "" || a != "" && a < b
+	})
+
+	c := Collection{Name: collection.Name}
+	for _, part := range collection.Parts {
+		partID, err := t.imdbID(ctx, "movie", part.ID)
+		if err != nil {
+			return Collection{}, err
+		}
+		if partID == "" {
+			continue
+		}
+		c.Movies = append(c.Movies, Meta{IMDbID: partID, Title: part.Title, Year: yearOf(part.ReleaseDate)})
+	}
+
+	return c, nil
+}
+
+// yearOf returns the year of a TMDB date like "2006-11-14".
+func yearOf(date string) int {
+	year, _ := strconv.Atoi(strings.Split(date, "-")[0])
+	return year
+}
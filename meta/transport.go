@@ -0,0 +1,7 @@
+//go:build !(js && wasm)
+
+package meta
+
+import "net/http"
+
+var defaultTransport = http.DefaultTransport
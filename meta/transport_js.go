@@ -0,0 +1,18 @@
+//go:build js && wasm
+
+package meta
+
+import "net/http"
+
+// fetchTransport sends requests through the browser Fetch API as plain CORS
+// requests without cookies, which is what public metadata APIs expect.
+type fetchTransport struct{}
+
+func (fetchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("js.fetch:mode", "cors")
+	req.Header.Set("js.fetch:credentials", "omit")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var defaultTransport http.RoundTripper = fetchTransport{}
@@ -0,0 +1,169 @@
+package parse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	seasonEpisodeRegex = regexp.MustCompile(`(?i)\bs(\d{1,2})[ ._-]?e(\d{1,3})((?:[ ._]?-?[ ._]?e\d{1,3}|-\d{1,3}\b)*)`)
+	crossEpisodeRegex  = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	seasonRegex        = regexp.MustCompile(`(?i)\b(?:s|season[ ._-]?)(\d{1,2})\b`)
+	episodeListRegex   = regexp.MustCompile(`\d{1,3}`)
+	yearRegex          = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	resolutionRegex    = regexp.MustCompile(`(?i)\b(480p|576p|720p|1080p|2160p|4k)\b`)
+)
+
+// EditionTheatrical is the edition of releases without an edition marker.
+const EditionTheatrical = "Theatrical"
+
+var editions = []struct {
+	name string
+	// keyword is in every match, in lower case. Checking for it first
+	// skips most regex matches.
+	keyword string
+	regex   *regexp.Regexp
+}{
+	{"Director's Cut", "director", regexp.MustCompile(`(?i)\bdirector'?s?[ ._-]+cut\b`)},
+	{"Final Cut", "final", regexp.MustCompile(`(?i)\bfinal[ ._-]+cut\b`)},
+	{"Extended", "extended", regexp.MustCompile(`(?i)\bextended\b`)},
+	{"Ultimate", "ultimate", regexp.MustCompile(`(?i)\bultimate[ ._-]+(?:edition|cut)\b`)},
+	{"Anniversary", "anniversary", regexp.MustCompile(`(?i)\b(?:\d{1,3}(?:th|st|nd|rd)[ ._-]+)?anniversary\b`)},
+	{"Special Edition", "special", regexp.MustCompile(`(?i)\bspecial[ ._-]+edition\b`)},
+	{"Unrated", "unrated", regexp.MustCompile(`(?i)\bunrated\b`)},
+	{"Uncut", "uncut", regexp.MustCompile(`(?i)\buncut\b`)},
+	{"IMAX", "imax", regexp.MustCompile(`(?i)\bimax\b`)},
+	{"Criterion", "criterion", regexp.MustCompile(`(?i)\bcriterion\b`)},
+	{"Remastered", "remastered", regexp.MustCompile(`(?i)\bremastered\b`)},
+	{EditionTheatrical, "theatrical", regexp.MustCompile(`(?i)\btheatrical\b`)},
+}
+
+const (
+	// maxNameLength bounds the work done on names from public trackers.
+	maxNameLength = 512
+	// maxEpisodeSpan bounds ranges like S01E01-E99 to plausible multi
+	// episode releases.
+	maxEpisodeSpan = 30
+)
+
+type Release struct {
+	Title      string
+	Year       int
+	Season     int
+	Episodes   []int
+	Resolution string
+	Edition    string
+}
+
+// ParseRelease extracts what it can from a scene style release name
+// such as "Show.Name.S01E02E03.1080p.WEB.x264-GRP". Unknown parts are
+// left at their zero value. It accepts any input, including invalid
+// UTF-8, and never panics.
+func ParseRelease(name string) Release {
+	var r Release
+	name = strings.ToValidUTF8(name, "")
+	if len(name) > maxNameLength {
+		name = strings.ToValidUTF8(name[:maxNameLength], "")
+	}
+	titleEnd := len(name)
+
+	if m := seasonEpisodeRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		first, _ := strconv.Atoi(name[m[4]:m[5]])
+		r.Episodes = []int{first}
+		last := first
+		for _, s := range episodeListRegex.FindAllString(name[m[6]:m[7]], -1) {
+			n, _ := strconv.Atoi(s)
+			if n > last && n-last <= maxEpisodeSpan {
+				for i := last + 1; i <= n; i++ {
+					r.Episodes = append(r.Episodes, i)
+				}
+				last = n
+			}
+		}
+		titleEnd = m[0]
+	} else if m := crossEpisodeRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		episode, _ := strconv.Atoi(name[m[4]:m[5]])
+		r.Episodes = []int{episode}
+		titleEnd = m[0]
+	} else if m := seasonRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		titleEnd = m[0]
+	}
+
+	// The last year wins, so titles like "Blade Runner 2049" keep theirs.
+	if all := yearRegex.FindAllStringSubmatchIndex(name, -1); len(all) > 0 && all[len(all)-1][0] > 0 {
+		m := all[len(all)-1]
+		r.Year, _ = strconv.Atoi(name[m[2]:m[3]])
+		if m[0] < titleEnd {
+			titleEnd = m[0]
+		}
+	}
+
+	if m := resolutionRegex.FindStringSubmatchIndex(name); m != nil {
+		r.Resolution = strings.ToLower(name[m[2]:m[3]])
+		if r.Resolution == "4k" {
+			r.Resolution = "2160p"
+		}
+		if m[0] < titleEnd {
+			titleEnd = m[0]
+		}
+	}
+
+	var start int
+	if r.Edition, start = parseEdition(name); start >= 0 && start < titleEnd {
+		titleEnd = start
+	}
+
+	r.Title = strings.Join(strings.FieldsFunc(name[:titleEnd], func(r rune) bool {
+		return r == '.' || r == '_' || r == ' ' || r == '-' || r == '(' || r == '['
+	}), " ")
+
+	return r
+}
+
+// HasEpisode reports whether the release contains the given episode.
+func (r Release) HasEpisode(season, episode int) bool {
+	if r.Season != season {
+		return false
+	}
+	for _, e := range r.Episodes {
+		if e == episode {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEdition returns only the edition of a release name, which is much
+// cheaper than ParseRelease.
+func ParseEdition(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	if len(name) > maxNameLength {
+		name = strings.ToValidUTF8(name[:maxNameLength], "")
+	}
+	edition, _ := parseEdition(name)
+	return edition
+}
+
+// parseEdition returns the edition of name and where its marker starts, -1
+// for theatrical releases without one. Markers at the start are part of
+// the title.
+func parseEdition(name string) (string, int) {
+	lower := strings.ToLower(name)
+	// (?i) also folds the long s to s, which ToLower keeps.
+	if strings.Contains(lower, "ſ") {
+		lower = strings.ReplaceAll(lower, "ſ", "s")
+	}
+	for _, edition := range editions {
+		if !strings.Contains(lower, edition.keyword) {
+			continue
+		}
+		if m := edition.regex.FindStringIndex(name); m != nil && m[0] > 0 {
+			return edition.name, m[0]
+		}
+	}
+	return EditionTheatrical, -1
+}
@@ -0,0 +1,139 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var releaseSeeds = []string{
+	"Show.Name.S01E02E03.1080p.WEB.x264-GRP",
+	"Show Name S02E01-E04 720p",
+	"Show.Name.1x05.HDTV",
+	"Show.Name.Season.3.Complete",
+	"Blade.Runner.2049.2017.2160p.UHD",
+	"Blade.Runner.1982.Final.Cut.1080p.BluRay",
+	"Aliens.1986.Directors.Cut.4K",
+	"S01E01E99E999",
+	"\xff\xfe.S01E01",
+	"",
+}
+
+func FuzzParseRelease(f *testing.F) {
+	for _, seed := range releaseSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		r := ParseRelease(name)
+
+		if len(r.Title) > maxNameLength {
+			t.Errorf("title of %q is %v bytes, more than %v", name, len(r.Title), maxNameLength)
+		}
+		if !utf8.ValidString(r.Title) {
+			t.Errorf("title of %q is invalid UTF-8: %q", name, r.Title)
+		}
+		if r.Season < 0 || r.Season > 99 {
+			t.Errorf("season of %q is %v", name, r.Season)
+		}
+		if r.Year != 0 && (r.Year < 1900 || r.Year > 2099) {
+			t.Errorf("year of %q is %v", name, r.Year)
+		}
+		switch r.Resolution {
+		case "", "480p", "576p", "720p", "1080p", "2160p":
+		default:
+			t.Errorf("resolution of %q is %q", name, r.Resolution)
+		}
+		if r.Edition != ParseEdition(name) {
+			t.Errorf("edition of %q is %q, ParseEdition says %q", name, r.Edition, ParseEdition(name))
+		}
+
+		for i, e := range r.Episodes {
+			if e < 0 || e > 999 {
+				t.Errorf("episode of %q is %v", name, e)
+			}
+			// Ranges are expanded, so episodes go up one at a time, and
+			// no range spans more than maxEpisodeSpan.
+			if i > 0 && e != r.Episodes[i-1]+1 {
+				t.Errorf("episodes of %q aren't consecutive: %v", name, r.Episodes)
+			}
+			if !r.HasEpisode(r.Season, e) {
+				t.Errorf("release %q doesn't have its episode %v", name, e)
+			}
+		}
+		// Every range end is a number in the name and adds at most
+		// maxEpisodeSpan episodes.
+		if groups := len(episodeListRegex.FindAllString(name, -1)); len(r.Episodes) > 1+maxEpisodeSpan*groups {
+			t.Errorf("%q has %v episodes from %v numbers: %v", name, len(r.Episodes), groups, r.Episodes)
+		}
+	})
+}
+
+func FuzzParseEdition(f *testing.F) {
+	for _, seed := range releaseSeeds {
+		f.Add(seed)
+	}
+	known := map[string]bool{}
+	for _, edition := range editions {
+		known[edition.name] = true
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		edition := ParseEdition(name)
+		if !known[edition] {
+			t.Errorf("edition of %q is unknown: %q", name, edition)
+		}
+		// Only the first maxNameLength bytes of valid UTF-8 are looked at.
+		valid := strings.ToValidUTF8(name, "")
+		if len(valid) > maxNameLength && ParseEdition(valid[:maxNameLength]+" Extended") != ParseEdition(valid[:maxNameLength]) {
+			t.Errorf("edition of %q depends on bytes past %v", name, maxNameLength)
+		}
+	})
+}
+
+func TestParseEdition(t *testing.T) {
+	tests := []struct {
+		name    string
+		edition string
+		title   string
+	}{
+		{"Blade.Runner.1982.Final.Cut.1080p.BluRay", "Final Cut", "Blade Runner"},
+		{"Aliens.1986.Directors.Cut.4K", "Director's Cut", "Aliens"},
+		{"Aliens 1986 Director's Cut 1080p", "Director's Cut", "Aliens"},
+		{"Movie.2001.25th.Anniversary.Edition.720p", "Anniversary", "Movie"},
+		{"Movie.2001.REMASTERED.UNRATED.1080p", "Unrated", "Movie"},
+		{"Movie.2001.IMAX.2160p", "IMAX", "Movie"},
+		{"Extended.Family.2010.1080p", EditionTheatrical, "Extended Family"},
+		{"Movie.2001.Extendedly.1080p", EditionTheatrical, "Movie"},
+		{"Movie.2001.Xſpecial.Edition.720p", "Special Edition", "Movie"},
+		{"Movie.2001.1080p", EditionTheatrical, "Movie"},
+	}
+	for _, test := range tests {
+		if edition := ParseEdition(test.name); edition != test.edition {
+			t.Errorf("ParseEdition(%q) = %q, want %q", test.name, edition, test.edition)
+		}
+		r := ParseRelease(test.name)
+		if r.Edition != test.edition || r.Title != test.title {
+			t.Errorf("ParseRelease(%q) has edition %q and title %q, want %q and %q", test.name, r.Edition, r.Title, test.edition, test.title)
+		}
+	}
+}
+
+// FuzzEditionKeywords checks that skipping editions by keyword finds the
+// same edition as matching every regex.
+func FuzzEditionKeywords(f *testing.F) {
+	for _, seed := range releaseSeeds {
+		f.Add(seed)
+	}
+	f.Add("Movie.2001.Xſpecial.Edition")
+	f.Fuzz(func(t *testing.T, name string) {
+		want, wantStart := EditionTheatrical, -1
+		for _, edition := range editions {
+			if m := edition.regex.FindStringIndex(name); m != nil && m[0] > 0 {
+				want, wantStart = edition.name, m[0]
+				break
+			}
+		}
+		if got, start := parseEdition(name); got != want || start != wantStart {
+			t.Errorf("parseEdition(%q) = %q, %v, want %q, %v", name, got, start, want, wantStart)
+		}
+	})
+}
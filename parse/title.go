@@ -0,0 +1,124 @@
+package parse
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ą': "a", 'ă': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe", 'ř': "r", 'ß': "ss", 'ś': "s", 'š': "s", 'ş': "s", 'ť': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+var articles = []string{"the ", "a ", "an "}
+
+var romanPrefixes = map[string]bool{
+	"part": true, "chapter": true, "vol": true, "volume": true, "book": true, "episode": true,
+}
+
+var romanValues = map[rune]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100, 'd': 500, 'm': 1000}
+
+// Transliterate replaces accented and special latin letters with
+// their closest ASCII spelling, e.g. é→e and ß→ss.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		t, ok := transliterations[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if lower != r {
+			t = strings.ToUpper(t[:1]) + t[1:]
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// SanitizeTitle turns a title into a search string accepted by title
+// based providers: transliterated, without punctuation and with
+// collapsed whitespace. Case is preserved.
+func SanitizeTitle(title string) string {
+	title = Transliterate(title)
+	title = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(title)
+	fields := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// NormalizeTitle returns a canonical form of title for comparisons:
+// sanitized, lower case, without leading article and with roman
+// numerals replaced by numbers.
+func NormalizeTitle(title string) string {
+	title = strings.ToLower(SanitizeTitle(title))
+	for _, article := range articles {
+		if strings.HasPrefix(title, article) && len(title) > len(article) {
+			title = title[len(article):]
+			break
+		}
+	}
+
+	words := strings.Fields(title)
+	for i, word := range words {
+		if len(word) == 1 && (i == 0 || !romanPrefixes[words[i-1]]) {
+			continue
+		}
+		if n, ok := romanToInt(word); ok {
+			words[i] = strconv.Itoa(n)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// TitlesEqual reports whether a and b are the same title once normalized.
+func TitlesEqual(a, b string) bool {
+	return NormalizeTitle(a) == NormalizeTitle(b)
+}
+
+// romanToInt parses small canonical roman numerals (1-39), which is the
+// range used for sequels and parts. Anything else is rejected so that
+// words like "mix" or "did" are left alone.
+func romanToInt(s string) (int, bool) {
+	total, prev := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		v, ok := romanValues[rune(s[i])]
+		if !ok {
+			return 0, false
+		}
+		if v < prev {
+			total -= v
+		} else {
+			total += v
+			prev = v
+		}
+	}
+	if total < 1 || total > 39 || intToRoman(total) != s {
+		return 0, false
+	}
+	return total, true
+}
+
+func intToRoman(n int) string {
+	var b strings.Builder
+	for _, p := range []struct {
+		v int
+		s string
+	}{{10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"}} {
+		for n >= p.v {
+			b.WriteString(p.s)
+			n -= p.v
+		}
+	}
+	return b.String()
+}
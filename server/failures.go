@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+type failuresHandler struct {
+	failures *torrent.FailureCache
+	logger   *zap.Logger
+}
+
+// NewFailuresHandler manages the failure cache of a Torrent:
+//
+//	GET /
+//	DELETE /?provider=RARBG&key=tt0111161
+//	DELETE /
+//
+// GET lists the recorded failures as torrent.Failure values. DELETE resets
+// the failures of one provider lookup, or all failures without provider and
+// key. Failures can carry upstream URLs, so the handler belongs behind
+// APIKeyAuth. A nil failure cache, as returned by a Torrent without one, is
+// answered with 404.
+func NewFailuresHandler(failures *torrent.FailureCache, logger *zap.Logger) http.Handler {
+	return &failuresHandler{failures: failures, logger: logger}
+}
+
+func (h *failuresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.failures == nil {
+		http.Error(w, "failure cache disabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.failures.Failures())
+	case http.MethodDelete:
+		query := r.URL.Query()
+		provider, key := query.Get("provider"), query.Get("key")
+		switch {
+		case provider == "" && key == "":
+			h.failures.Clear()
+			torrent.ContextLogger(r.Context(), h.logger).Info("cleared provider failures")
+		case provider != "" && key != "":
+			h.failures.Reset(provider, key)
+			torrent.ContextLogger(r.Context(), h.logger).Info("reset provider failure",
+				zap.String("provider", provider), zap.String("key", key))
+		default:
+			http.Error(w, "provider and key required together", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
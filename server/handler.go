@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+type handler struct {
+	finder torrent.MagnetFinder
+	logger *zap.Logger
+}
+
+// NewHandler serves lookups as JSON:
+//
+//	GET [/<profile>]/movie/<imdb id>
+//	GET [/<profile>]/episode/<imdb id>/<season>/<episode>
+//
+// The optional profile is an encoded Profile, which can also be sent as
+// X-Profile header. Responses are a torrent.ResultSet, whose "degraded"
+// list names the providers that failed or timed out, without their errors.
+func NewHandler(finder torrent.MagnetFinder, logger *zap.Logger) http.Handler {
+	return &handler{finder: finder, logger: logger}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	encodedProfile := r.Header.Get("X-Profile")
+	if len(parts) > 0 && parts[0] != "movie" && parts[0] != "episode" {
+		encodedProfile, parts = parts[0], parts[1:]
+	}
+
+	var profile Profile
+	ctx := r.Context()
+	if encodedProfile != "" {
+		var err error
+		if profile, err = DecodeProfile(encodedProfile); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx = WithProfile(ctx, profile)
+	}
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		ctx = torrent.WithRequestID(ctx, id)
+	}
+
+	var set torrent.ResultSet
+	var err error
+	switch {
+	case len(parts) == 2 && parts[0] == "movie":
+		set, err = h.findMovie(ctx, parts[1])
+	case len(parts) == 4 && parts[0] == "episode":
+		season, serr := strconv.Atoi(parts[2])
+		episode, eerr := strconv.Atoi(parts[3])
+		if serr != nil || eerr != nil {
+			http.Error(w, "invalid season or episode", http.StatusBadRequest)
+			return
+		}
+		set, err = h.findEpisode(ctx, parts[1], season, episode)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		// The path can hold the encoded profile with its debrid keys, so
+		// only the route and ID are logged.
+		torrent.ContextLogger(ctx, h.logger).Error("couldn't find torrents", zap.Error(err),
+			zap.String("route", parts[0]), zap.String("id", parts[1]))
+		// Provider errors can carry upstream URLs, so clients only get a
+		// generic message; the details are in the log.
+		http.Error(w, "couldn't find torrents", http.StatusBadGateway)
+		return
+	}
+
+	for i := range set.Degraded {
+		set.Degraded[i].Error = ""
+	}
+
+	set.Results = profile.Apply(set.Results)
+	if set.Results == nil {
+		set.Results = []torrent.Result{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+// findMovie reports degraded providers if the finder supports it.
+func (h *handler) findMovie(ctx context.Context, imdbID string) (torrent.ResultSet, error) {
+	if f, ok := h.finder.(torrent.ResultSetFinder); ok {
+		return f.FindMovieSet(ctx, imdbID)
+	}
+	results, err := h.finder.FindMovie(ctx, imdbID)
+	return torrent.ResultSet{Results: results}, err
+}
+
+func (h *handler) findEpisode(ctx context.Context, imdbID string, season, episode int) (torrent.ResultSet, error) {
+	if f, ok := h.finder.(torrent.ResultSetFinder); ok {
+		return f.FindEpisodeSet(ctx, imdbID, season, episode)
+	}
+	results, err := h.finder.FindEpisode(ctx, imdbID, season, episode)
+	return torrent.ResultSet{Results: results}, err
+}
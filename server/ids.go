@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+// maxIDs is the maximum number of IDs per translation request.
+const maxIDs = 500
+
+type idHandler struct {
+	translator *meta.IDTranslator
+	logger     *zap.Logger
+}
+
+// NewIDHandler translates IDs in bulk:
+//
+//	GET /?kind=imdb&ids=tt0111161,tt0068646
+//
+// kind is one of the meta.IDKind values. The response maps every found ID
+// to its meta.ExternalIDs.
+func NewIDHandler(translator *meta.IDTranslator, logger *zap.Logger) http.Handler {
+	return &idHandler{translator: translator, logger: logger}
+}
+
+func (h *idHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var ids []string
+	for _, id := range strings.Split(query.Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxIDs {
+		http.Error(w, "between 1 and 500 ids required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	translated, err := h.translator.Translate(ctx, meta.IDKind(query.Get("kind")), ids)
+	if err != nil {
+		torrent.ContextLogger(ctx, h.logger).Error("couldn't translate IDs", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(translated)
+}
@@ -0,0 +1,223 @@
+// Package server contains the HTTP layer for serving lookups: composable
+// middleware and the handlers built on it.
+package server
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+)
+
+// Middleware wraps a handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middleware, the first one being the outermost.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// APIKeyAuth rejects requests without one of keys, passed either as
+// "Authorization: Bearer <key>", as X-Api-Key header or as apikey query
+// parameter. The query parameter is for clients like Stremio which can
+// only be configured with a URL.
+func APIKeyAuth(keys ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !validKey(requestKey(r), keys) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="imdb"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apikey")
+}
+
+func validKey(key string, keys []string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, k := range keys {
+		// Compare against every key, so timing doesn't tell which matched.
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+type CORSOptions struct {
+	// AllowedOrigins are the allowed origins, "*" allows all.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+var DefaultCORSOpts = CORSOptions{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodOptions},
+	AllowedHeaders: []string{"Authorization", "Content-Type", "X-Api-Key", "X-Request-ID"},
+	MaxAge:         time.Hour,
+}
+
+// CORS adds CORS headers for allowed origins and answers preflight requests.
+func CORS(opts CORSOptions) Middleware {
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed, wildcard := allowedOrigin(origin, opts.AllowedOrigins)
+			if origin == "" || !allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if wildcard {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func allowedOrigin(origin string, allowed []string) (ok, wildcard bool) {
+	for _, a := range allowed {
+		if a == "*" {
+			return true, true
+		}
+		if strings.EqualFold(a, origin) {
+			ok = true
+		}
+	}
+	return ok, false
+}
+
+type RateLimitOptions struct {
+	// Rate is the number of requests per second a client may make on
+	// average, Burst how many it may make at once. Values of 0 or less
+	// are replaced by those of DefaultRateLimitOpts.
+	Rate  float64
+	Burst int
+	// Key identifies the client of a request, by default its remote IP.
+	Key func(r *http.Request) string
+	// Clock is the time source of the buckets, torrent.SystemClock if nil.
+	Clock torrent.Clock
+}
+
+var DefaultRateLimitOpts = RateLimitOptions{
+	Rate:  1,
+	Burst: 10,
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit limits every client to opts.Rate requests per second with a
+// token bucket, answering excess requests with 429 Too Many Requests.
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Rate <= 0 {
+		opts.Rate = DefaultRateLimitOpts.Rate
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = DefaultRateLimitOpts.Burst
+	}
+	key := opts.Key
+	if key == nil {
+		key = remoteIP
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = torrent.SystemClock
+	}
+
+	buckets := map[string]*bucket{}
+	lock := &sync.Mutex{}
+	// Full buckets are dropped every so often, they are recreated full.
+	lastSweep := clock.Now()
+	sweepAfter := time.Duration(float64(opts.Burst)/opts.Rate*float64(time.Second)) + time.Minute
+
+	take := func(client string) time.Duration {
+		lock.Lock()
+		defer lock.Unlock()
+
+		now := clock.Now()
+		if now.Sub(lastSweep) > sweepAfter {
+			for k, b := range buckets {
+				if now.Sub(b.last) > sweepAfter {
+					delete(buckets, k)
+				}
+			}
+			lastSweep = now
+		}
+
+		b, ok := buckets[client]
+		if !ok {
+			b = &bucket{tokens: float64(opts.Burst), last: now}
+			buckets[client] = b
+		}
+		b.tokens = math.Min(float64(opts.Burst), b.tokens+now.Sub(b.last).Seconds()*opts.Rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			return 0
+		}
+		return time.Duration((1 - b.tokens) / opts.Rate * float64(time.Second))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait := take(key(r)); wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
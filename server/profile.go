@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jelliflix/imdb/torrent"
+)
+
+// Profile holds the preferences of one user. It is encoded into the
+// request path or the X-Profile header, so a hosted instance can serve
+// many users without storing anything.
+type Profile struct {
+	// Qualities are the accepted resolutions like "1080p", most preferred
+	// first. Empty accepts all.
+	Qualities []string `json:"qualities,omitempty"`
+	// ExcludeCam drops cam and telesync releases.
+	ExcludeCam bool `json:"excludeCam,omitempty"`
+	// Languages are accepted audio languages as ISO 639-1 codes. Releases
+	// without a language tag count as English.
+	Languages []string `json:"languages,omitempty"`
+	// MaxSize is the maximum size in bytes, 0 for no limit.
+	MaxSize int `json:"maxSize,omitempty"`
+	// Limit is the maximum number of results, 0 for no limit.
+	Limit int `json:"limit,omitempty"`
+	// DebridKeys are API keys of debrid services by service name. They are
+	// not used here but passed on to finders through the context.
+	DebridKeys map[string]string `json:"debridKeys,omitempty"`
+}
+
+// EncodeProfile returns p as URL safe string for paths and headers.
+func EncodeProfile(p Profile) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func DecodeProfile(s string) (Profile, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return Profile{}, fmt.Errorf("couldn't decode profile: %v", err)
+	}
+	var p Profile
+	if err = json.Unmarshal(data, &p); err != nil {
+		return Profile{}, fmt.Errorf("couldn't parse profile: %v", err)
+	}
+	return p, nil
+}
+
+type profileKey struct{}
+
+// WithProfile attaches the profile of the requesting user to ctx.
+func WithProfile(ctx context.Context, p Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, p)
+}
+
+// ProfileFrom returns the profile of the requesting user, e.g. for finders
+// that need the user's debrid keys.
+func ProfileFrom(ctx context.Context) (Profile, bool) {
+	p, ok := ctx.Value(profileKey{}).(Profile)
+	return p, ok
+}
+
+var languageTags = map[string]*regexp.Regexp{
+	"en": regexp.MustCompile(`(?i)\b(english|eng)\b`),
+	"de": regexp.MustCompile(`(?i)\b(german|ger|deutsch)\b`),
+	"fr": regexp.MustCompile(`(?i)\b(french|fre|truefrench|vff|vostfr)\b`),
+	"es": regexp.MustCompile(`(?i)\b(spanish|spa|castellano|latino)\b`),
+	"it": regexp.MustCompile(`(?i)\b(italian|ita)\b`),
+	"pt": regexp.MustCompile(`(?i)\b(portuguese|por|dublado)\b`),
+	"ru": regexp.MustCompile(`(?i)\b(russian|rus)\b`),
+	"ja": regexp.MustCompile(`(?i)\b(japanese|jpn)\b`),
+	"ko": regexp.MustCompile(`(?i)\b(korean|kor)\b`),
+	"hi": regexp.MustCompile(`(?i)\b(hindi|hin)\b`),
+}
+
+var multiLanguage = regexp.MustCompile(`(?i)\b(multi|dual[ ._-]?audio)\b`)
+
+// languages returns the language codes a release name is tagged with.
+func languages(name string) []string {
+	var langs []string
+	for lang, tag := range languageTags {
+		if tag.MatchString(name) {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+func (p Profile) keep(r torrent.Result) bool {
+	if p.MaxSize > 0 && r.Size > p.MaxSize {
+		return false
+	}
+	if p.ExcludeCam && (strings.Contains(r.Quality, "cam") || strings.Contains(r.Quality, "telesync")) {
+		return false
+	}
+	if len(p.Qualities) > 0 && p.qualityRank(r) < 0 {
+		return false
+	}
+	if len(p.Languages) > 0 && !multiLanguage.MatchString(r.Name) {
+		langs := languages(r.Name)
+		if len(langs) == 0 {
+			langs = []string{"en"}
+		}
+		if !overlaps(langs, p.Languages) {
+			return false
+		}
+	}
+	return true
+}
+
+// qualityRank is the position of the result's resolution in Qualities, -1
+// if it isn't accepted.
+func (p Profile) qualityRank(r torrent.Result) int {
+	fields := strings.Fields(r.Quality)
+	if len(fields) == 0 {
+		return -1
+	}
+	for i, q := range p.Qualities {
+		if strings.EqualFold(q, fields[0]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Apply filters results by the profile and orders them by preferred
+// quality first and Score second.
+func (p Profile) Apply(results []torrent.Result) []torrent.Result {
+	var kept []torrent.Result
+	for _, r := range results {
+		if p.keep(r) {
+			kept = append(kept, r)
+		}
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		if len(p.Qualities) > 0 {
+			if a, b := p.qualityRank(kept[i]), p.qualityRank(kept[j]); a != b {
+				return a < b
+			}
+		}
+		return torrent.Score(kept[i]) > torrent.Score(kept[j])
+	})
+
+	if p.Limit > 0 && len(kept) > p.Limit {
+		kept = kept[:p.Limit]
+	}
+	return kept
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
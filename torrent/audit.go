@@ -0,0 +1,100 @@
+package torrent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one outbound provider request. URL and Params have
+// credentials redacted.
+type AuditRecord struct {
+	Time      time.Time           `json:"time"`
+	RequestID string              `json:"requestId,omitempty"`
+	Provider  string              `json:"provider"`
+	Method    string              `json:"method"`
+	URL       string              `json:"url"`
+	Params    map[string][]string `json:"params,omitempty"`
+	Status    int                 `json:"status"`
+	Duration  time.Duration       `json:"duration"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// AuditSink records every outbound provider request, e.g. to show that an
+// API is used respectfully or to find out why a provider banned a client.
+// Other backends, like SQLite, only need to implement Record.
+type AuditSink interface {
+	Record(record AuditRecord) error
+}
+
+var _ AuditSink = (*FileAuditSink)(nil)
+
+// FileAuditSink appends records to a JSON lines file.
+type FileAuditSink struct {
+	file *os.File
+	lock *sync.Mutex
+}
+
+// NewFileAuditSink opens path for appending, creating it if needed.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open audit file: %v", err)
+	}
+	return &FileAuditSink{file: f, lock: &sync.Mutex{}}, nil
+}
+
+func (s *FileAuditSink) Record(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("couldn't write audit file: %v", err)
+	}
+	return nil
+}
+
+func (s *FileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+// AuditSubscriber records the upstream requests published on the event bus
+// in sink, e.g. subscribed to a Torrent for the requests of its lookups.
+// Hooks.Audit subscribes it for all requests of a provider. Errors of sink
+// are ignored, so auditing can't break lookups.
+func AuditSubscriber(sink AuditSink) Subscriber {
+	return func(ctx context.Context, event TraceEvent) {
+		if event.Kind != TraceRequest {
+			return
+		}
+		_ = sink.Record(AuditRecord{
+			Time:      event.Time.Add(-event.Duration),
+			RequestID: RequestID(ctx),
+			Provider:  event.Provider,
+			Method:    event.Method,
+			URL:       event.URL,
+			Params:    auditParams(event.URL),
+			Status:    event.Status,
+			Duration:  event.Duration,
+			Error:     event.Error,
+		})
+	}
+}
+
+func auditParams(redactedURL string) map[string][]string {
+	u, err := url.Parse(redactedURL)
+	if err != nil || u.RawQuery == "" {
+		return nil
+	}
+	return u.Query()
+}
@@ -0,0 +1,86 @@
+package torrent_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+var benchNames = []string{
+	"Show.Name.S01E02.1080p.WEB.x264-GRP",
+	"Movie.Title.2021.Directors.Cut.2160p.UHD.BluRay.x265-GRP",
+	"Show Name - S03E01-E03 - 720p HDTV",
+	"Movie Title (1999) [1080p] [BluRay] [5.1] [YTS.MX]",
+}
+
+// newBenchYTS returns a YTS factory for a fake upstream answering every
+// lookup with a response of 50 results, like the Decode budget assumes.
+func newBenchYTS(b *testing.B) torrenttest.BenchFactory {
+	var torrents []string
+	for i := 0; i < 50; i++ {
+		torrents = append(torrents, fmt.Sprintf(`{"hash":"%040x","quality":"1080p","type":"web","seeds":%v,"size_bytes":1000}`, i+1, i))
+	}
+	body := `{"status":"ok","data":{"movie_count":1,"movies":[{"title":"Big Buck Bunny","torrents":[` + strings.Join(torrents, ",") + `]}]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	b.Cleanup(server.Close)
+
+	return func(b *testing.B, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultYTSOpts
+		opts.BaseURL = server.URL
+		return torrent.NewYTS(opts, cache, zap.NewNop())
+	}
+}
+
+func BenchmarkCacheHit(b *testing.B) {
+	torrenttest.BenchmarkCacheHit(b, movieID, newBenchYTS(b))
+}
+
+func BenchmarkFanOut(b *testing.B) {
+	torrenttest.BenchmarkFanOut(b, 5, 50)
+}
+
+func BenchmarkParse(b *testing.B) {
+	torrenttest.BenchmarkParse(b, benchNames)
+}
+
+func BenchmarkDecode(b *testing.B) {
+	torrenttest.BenchmarkDecode(b, movieID, newBenchYTS(b))
+}
+
+// TestBudgets runs the benchmarks once and checks them against
+// torrenttest.Budgets. Timings depend on the machine, so it only runs with
+// IMDB_BUDGETS=1, and only checks allocations with -race.
+func TestBudgets(t *testing.T) {
+	if os.Getenv("IMDB_BUDGETS") != "1" {
+		t.Skip("skipping benchmarks, set IMDB_BUDGETS=1 to check them")
+	}
+
+	benchmarks := map[string]func(*testing.B){
+		"CacheHit": BenchmarkCacheHit,
+		"FanOut":   BenchmarkFanOut,
+		"Parse":    BenchmarkParse,
+		"Decode":   BenchmarkDecode,
+	}
+	for _, budget := range torrenttest.Budgets {
+		benchmark, ok := benchmarks[budget.Name]
+		if !ok {
+			t.Errorf("no benchmark for budget %v", budget.Name)
+			continue
+		}
+		if raceEnabled {
+			budget.NsPerOp = 0
+		}
+		if err := budget.Check(testing.Benchmark(benchmark)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package torrent
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
 	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 type CacheItem struct {
@@ -19,12 +25,19 @@ var _ Cache = (*InMemCache)(nil)
 
 type InMemCache struct {
 	cache map[string]CacheItem
+	clock Clock
 	*sync.RWMutex
 }
 
 func NewInMemCache() *InMemCache {
+	return NewInMemCacheWithClock(SystemClock)
+}
+
+// NewInMemCacheWithClock creates a cache recording creation times from
+// clock, so cache ages can be tested with a fake one.
+func NewInMemCacheWithClock(clock Clock) *InMemCache {
 	return &InMemCache{
-		map[string]CacheItem{}, &sync.RWMutex{},
+		map[string]CacheItem{}, clockOr(clock), &sync.RWMutex{},
 	}
 }
 
@@ -33,7 +46,7 @@ func (c *InMemCache) Set(key string, results []Result) error {
 	defer c.RWMutex.Unlock()
 	c.cache[key] = CacheItem{
 		Results: results,
-		Created: time.Now(),
+		Created: c.clock.Now(),
 	}
 	return nil
 }
@@ -44,3 +57,46 @@ func (c *InMemCache) Get(key string) ([]Result, time.Time, bool, error) {
 	cacheItem, found := c.cache[key]
 	return cacheItem.Results, cacheItem.Created, found, nil
 }
+
+// storeResults caches the results of a provider, logging failures.
+func storeResults(ctx context.Context, cache Cache, logger *zap.Logger, provider, key string, results []Result) {
+	err := cache.Set(key, results)
+	traceCacheWrite(ctx, provider, key, len(results), err)
+	if err != nil {
+		ContextLogger(ctx, logger).Error("couldn't cache torrents", zap.Error(err), zap.String("cache", "torrent"))
+	}
+}
+
+// CacheKey identifies a cached lookup by every dimension that influences its
+// results, so differently parameterized searches for the same ID don't share
+// cache entries.
+type CacheKey struct {
+	Provider string
+	ID       string
+	Season   int
+	Episode  int
+	Query    string
+	Params   url.Values
+}
+
+func (k CacheKey) String() string {
+	key := k.Provider + "/" + k.ID
+	if k.Season > 0 || k.Episode > 0 {
+		key += fmt.Sprintf("/S%02dE%02d", k.Season, k.Episode)
+	}
+
+	params := url.Values{}
+	for name, values := range k.Params {
+		values = append([]string(nil), values...)
+		sort.Strings(values)
+		params[name] = values
+	}
+	if k.Query != "" {
+		params.Set("q", k.Query)
+	}
+	if len(params) > 0 {
+		key += "?" + params.Encode()
+	}
+
+	return key
+}
@@ -0,0 +1,51 @@
+package torrent
+
+import "time"
+
+// Capabilities describes what a finder can search for, so aggregators and
+// servers can route queries instead of trying every finder for everything.
+type Capabilities struct {
+	IMDbSearch  bool
+	TitleSearch bool
+	Movies      bool
+	Episodes    bool
+	SeasonPacks bool
+	Categories  []string
+	// RateLimit is the minimum delay between two requests, 0 if unknown.
+	RateLimit time.Duration
+}
+
+// CapabilityProvider is implemented by finders describing their capabilities.
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities of finder. Finders not
+// implementing CapabilityProvider are assumed to support movies and episodes.
+func CapabilitiesOf(finder MagnetFinder) Capabilities {
+	if p, ok := finder.(CapabilityProvider); ok {
+		return p.Capabilities()
+	}
+	return Capabilities{Movies: true, Episodes: true}
+}
+
+// Capabilities combines the capabilities of all finders.
+func (t *Torrent) Capabilities() Capabilities {
+	var combined Capabilities
+	seen := map[string]bool{}
+	for _, client := range t.clients {
+		caps := CapabilitiesOf(client)
+		combined.IMDbSearch = combined.IMDbSearch || caps.IMDbSearch
+		combined.TitleSearch = combined.TitleSearch || caps.TitleSearch
+		combined.Movies = combined.Movies || caps.Movies
+		combined.Episodes = combined.Episodes || caps.Episodes
+		combined.SeasonPacks = combined.SeasonPacks || caps.SeasonPacks
+		for _, cat := range caps.Categories {
+			if !seen[cat] {
+				seen[cat] = true
+				combined.Categories = append(combined.Categories, cat)
+			}
+		}
+	}
+	return combined
+}
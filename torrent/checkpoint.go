@@ -0,0 +1,252 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Checkpoint is the outcome of one lookup of a season scan. Pack is set for
+// the season pack lookup, whose Episode is 0, so it doesn't collide with
+// the lookup of a special numbered E00.
+type Checkpoint struct {
+	IMDbID  string
+	Season  int
+	Episode int
+	Pack    bool
+	Results []Result
+}
+
+// CheckpointStore persists the progress of season scans, so an interrupted
+// scan resumes where it left off.
+type CheckpointStore interface {
+	AddCheckpoint(ctx context.Context, checkpoint Checkpoint) error
+	Checkpoints(ctx context.Context, imdbID string) ([]Checkpoint, error)
+	ClearCheckpoints(ctx context.Context, imdbID string) error
+}
+
+var (
+	_ CheckpointStore = (*MemCheckpointStore)(nil)
+	_ CheckpointStore = (*FileCheckpointStore)(nil)
+)
+
+type MemCheckpointStore struct {
+	checkpoints map[string][]Checkpoint
+	lock        *sync.Mutex
+}
+
+func NewMemCheckpointStore() *MemCheckpointStore {
+	return &MemCheckpointStore{checkpoints: map[string][]Checkpoint{}, lock: &sync.Mutex{}}
+}
+
+func (s *MemCheckpointStore) AddCheckpoint(_ context.Context, checkpoint Checkpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checkpoints[checkpoint.IMDbID] = append(s.checkpoints[checkpoint.IMDbID], checkpoint)
+	return nil
+}
+
+func (s *MemCheckpointStore) Checkpoints(_ context.Context, imdbID string) ([]Checkpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Checkpoint(nil), s.checkpoints[imdbID]...), nil
+}
+
+func (s *MemCheckpointStore) ClearCheckpoints(_ context.Context, imdbID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.checkpoints, imdbID)
+	return nil
+}
+
+// FileCheckpointStore appends checkpoints to a JSON lines file, so progress
+// survives a crash of the process.
+type FileCheckpointStore struct {
+	path string
+	lock *sync.Mutex
+}
+
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path, lock: &sync.Mutex{}}
+}
+
+func (s *FileCheckpointStore) AddCheckpoint(_ context.Context, checkpoint Checkpoint) error {
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("couldn't open checkpoint file: %v", err)
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("couldn't write checkpoint file: %v", err)
+	}
+	return f.Close()
+}
+
+func (s *FileCheckpointStore) Checkpoints(_ context.Context, imdbID string) ([]Checkpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	all, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []Checkpoint
+	for _, checkpoint := range all {
+		if checkpoint.IMDbID == imdbID {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	return checkpoints, nil
+}
+
+// ClearCheckpoints rewrites the file without the checkpoints of imdbID, and
+// removes it once no checkpoints are left.
+func (s *FileCheckpointStore) ClearCheckpoints(_ context.Context, imdbID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	all, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, checkpoint := range all {
+		if checkpoint.IMDbID == imdbID {
+			continue
+		}
+		line, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if len(data) == 0 {
+		if err = os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("couldn't remove checkpoint file: %v", err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("couldn't create temp file: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("couldn't write checkpoint file: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("couldn't write checkpoint file: %v", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileCheckpointStore) read() ([]Checkpoint, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't open checkpoint file: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var checkpoints []Checkpoint
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var checkpoint Checkpoint
+		// Skip lines torn by a crash during a write, the lookup is repeated.
+		if json.Unmarshal(scanner.Bytes(), &checkpoint) == nil {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	return checkpoints, scanner.Err()
+}
+
+type checkpointKey struct {
+	season, episode int
+	pack            bool
+}
+
+// resumeState holds the lookups of an earlier, interrupted scan and records
+// new ones.
+type resumeState struct {
+	store  CheckpointStore
+	imdbID string
+	done   map[checkpointKey][]Result
+	logger *zap.Logger
+
+	failed bool
+	lock   *sync.Mutex
+}
+
+func loadResumeState(ctx context.Context, store CheckpointStore, imdbID string, logger *zap.Logger) (*resumeState, error) {
+	state := &resumeState{store: store, imdbID: imdbID, done: map[checkpointKey][]Result{}, logger: logger, lock: &sync.Mutex{}}
+	if store == nil {
+		return state, nil
+	}
+	checkpoints, err := store.Checkpoints(ctx, imdbID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load checkpoints of %v: %v", imdbID, err)
+	}
+	for _, checkpoint := range checkpoints {
+		state.done[checkpointKey{checkpoint.Season, checkpoint.Episode, checkpoint.Pack}] = checkpoint.Results
+	}
+	return state, nil
+}
+
+// lookup returns the checkpointed results of a lookup, or runs find and
+// checkpoints its results if it succeeds. Failed lookups are repeated on
+// resumption.
+func (s *resumeState) lookup(ctx context.Context, key checkpointKey, find func() ([]Result, error)) ([]Result, error) {
+	if results, ok := s.done[key]; ok {
+		return results, nil
+	}
+	results, err := find()
+	if err != nil {
+		s.lock.Lock()
+		s.failed = true
+		s.lock.Unlock()
+		return results, err
+	}
+	if s.store == nil {
+		return results, nil
+	}
+	checkpoint := Checkpoint{IMDbID: s.imdbID, Season: key.season, Episode: key.episode, Pack: key.pack, Results: results}
+	if err = s.store.AddCheckpoint(ctx, checkpoint); err != nil {
+		ContextLogger(ctx, s.logger).Error("couldn't save checkpoint", zap.Error(err),
+			zap.String("id", s.imdbID), zap.Int("season", key.season), zap.Int("episode", key.episode), zap.Bool("pack", key.pack))
+	}
+	return results, nil
+}
+
+// clear removes the checkpoints once every lookup of the scan succeeded.
+func (s *resumeState) clear(ctx context.Context) {
+	s.lock.Lock()
+	failed := s.failed
+	s.lock.Unlock()
+	if s.store == nil || failed || ctx.Err() != nil {
+		return
+	}
+	if err := s.store.ClearCheckpoints(ctx, s.imdbID); err != nil {
+		ContextLogger(ctx, s.logger).Error("couldn't clear checkpoints", zap.Error(err), zap.String("id", s.imdbID))
+	}
+}
@@ -0,0 +1,32 @@
+package torrent
+
+import "time"
+
+// Clock is the time source of token expiry, cache ages, failure backoff and
+// pacing. Tests can pass a fake one, like torrenttest.FakeClock, to
+// simulate them without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clockOr returns c, or SystemClock if c is nil.
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
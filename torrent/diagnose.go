@@ -0,0 +1,164 @@
+package torrent
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NoResultsReason explains why an episode lookup found nothing.
+type NoResultsReason string
+
+const (
+	// NoResultsFiltered means providers returned results, but the pipeline
+	// dropped all of them, e.g. by a filter or page.
+	NoResultsFiltered NoResultsReason = "filtered"
+	// NoResultsTooNew means the episode hasn't aired, or aired too recently
+	// to be on trackers yet.
+	NoResultsTooNew NoResultsReason = "too_new"
+	// NoResultsEpisodeAbsent means trackers have the series, but not the
+	// episode.
+	NoResultsEpisodeAbsent NoResultsReason = "episode_absent"
+	// NoResultsSeriesAbsent means trackers have no torrents of the series
+	// at all.
+	NoResultsSeriesAbsent NoResultsReason = "series_absent"
+)
+
+// Diagnosis is the outcome of an episode lookup, with the reason it found
+// nothing. Reason is empty when Results aren't. Degraded providers may be
+// the actual cause of any reason.
+type Diagnosis struct {
+	Results  []Result        `json:"results"`
+	Reason   NoResultsReason `json:"reason,omitempty"`
+	Degraded []Degraded      `json:"degraded,omitempty"`
+	// Found is the number of results providers returned before the
+	// pipeline ran.
+	Found int `json:"found,omitempty"`
+	// Released is the air date of the episode, zero if unknown.
+	Released time.Time `json:"released"`
+}
+
+type DiagnoserOptions struct {
+	// RecentAge is how long after airing an episode without results counts
+	// as too new rather than absent.
+	RecentAge time.Duration
+
+	// Clock is the time source of RecentAge, SystemClock if nil.
+	Clock Clock
+}
+
+var DefaultDiagnoserOpts = DiagnoserOptions{
+	RecentAge: 48 * time.Hour,
+}
+
+// Diagnoser looks up episodes like FindEpisode, and when nothing is found
+// probes why, so apps can tell users "not yet on trackers" instead of just
+// "no results".
+type Diagnoser struct {
+	opts    DiagnoserOptions
+	finder  MagnetFinder
+	seasons SeasonGetter
+	clock   Clock
+	logger  *zap.Logger
+}
+
+// NewDiagnoser creates a diagnoser. seasons provides air dates and may be
+// nil, in which case episodes are never reported as too new.
+func NewDiagnoser(opts DiagnoserOptions, finder MagnetFinder, seasons SeasonGetter, logger *zap.Logger) *Diagnoser {
+	return &Diagnoser{
+		opts:    opts,
+		finder:  finder,
+		seasons: seasons,
+		clock:   clockOr(opts.Clock),
+		logger:  logger,
+	}
+}
+
+// Diagnose looks up an episode. Without results, it checks in order
+// whether the pipeline dropped them, whether the episode is too new, and
+// whether the series has any torrents: season packs of the season, or the
+// first episode of the series. The probes are extra lookups, mostly served
+// by the provider caches.
+func (d *Diagnoser) Diagnose(ctx context.Context, imdbID string, season, episode int) (Diagnosis, error) {
+	collector := NewTraceCollector()
+	traced := WithTrace(ctx, collector)
+
+	var diagnosis Diagnosis
+	var err error
+	if f, ok := d.finder.(ResultSetFinder); ok {
+		var set ResultSet
+		set, err = f.FindEpisodeSet(traced, imdbID, season, episode)
+		diagnosis.Results, diagnosis.Degraded = set.Results, set.Degraded
+	} else {
+		diagnosis.Results, err = d.finder.FindEpisode(traced, imdbID, season, episode)
+	}
+	// Hand the events on to the caller's trace, which traced replaced.
+	if outer := traceFrom(ctx); outer != nil {
+		for _, event := range collector.Events() {
+			outer.add(event)
+		}
+	}
+	if err != nil {
+		return Diagnosis{}, err
+	}
+	if len(diagnosis.Results) > 0 {
+		return diagnosis, nil
+	}
+
+	for _, event := range collector.Events() {
+		if event.Kind == TraceProvider {
+			diagnosis.Found += event.Results
+		}
+	}
+	if diagnosis.Found > 0 {
+		diagnosis.Reason = NoResultsFiltered
+		return diagnosis, nil
+	}
+
+	if diagnosis.Released = d.released(ctx, imdbID, season, episode); !diagnosis.Released.IsZero() &&
+		d.clock.Now().Sub(diagnosis.Released) < d.opts.RecentAge {
+		diagnosis.Reason = NoResultsTooNew
+		return diagnosis, nil
+	}
+
+	diagnosis.Reason = NoResultsSeriesAbsent
+	if d.seriesPresent(ctx, imdbID, season, episode) {
+		diagnosis.Reason = NoResultsEpisodeAbsent
+	}
+	return diagnosis, nil
+}
+
+// released returns the air date of the episode, zero if unknown.
+func (d *Diagnoser) released(ctx context.Context, imdbID string, season, episode int) time.Time {
+	if d.seasons == nil {
+		return time.Time{}
+	}
+	episodes, err := d.seasons.GetSeason(ctx, imdbID, season)
+	if err != nil {
+		ContextLogger(ctx, d.logger).Error("couldn't get air date", zap.Error(err),
+			zap.String("id", imdbID), zap.Int("season", season), zap.Int("episode", episode))
+		return time.Time{}
+	}
+	for _, e := range episodes {
+		if e.Episode == episode {
+			return e.Released
+		}
+	}
+	return time.Time{}
+}
+
+// seriesPresent probes for any torrents of the series.
+func (d *Diagnoser) seriesPresent(ctx context.Context, imdbID string, season, episode int) bool {
+	if f, ok := d.finder.(SeasonFinder); ok {
+		// Failed providers don't tell anything, results of the others do.
+		if packs, _ := f.FindSeason(ctx, imdbID, season); len(packs) > 0 {
+			return true
+		}
+	}
+	if season == 1 && episode == 1 {
+		return false
+	}
+	results, _ := d.finder.FindEpisode(ctx, imdbID, 1, 1)
+	return len(results) > 0
+}
@@ -0,0 +1,96 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jelliflix/imdb/parse"
+)
+
+type EditionGroup struct {
+	Edition string
+	Results []Result
+}
+
+// GroupByEdition groups results by the edition parsed from their names,
+// e.g. theatrical, director's cut or extended. Groups keep the order in
+// which their editions first appear, as do the results within a group.
+func GroupByEdition(results []Result) []EditionGroup {
+	var groups []EditionGroup
+	index := map[string]int{}
+	for _, result := range results {
+		edition := editionOf(result)
+		i, ok := index[edition]
+		if !ok {
+			i = len(groups)
+			index[edition] = i
+			groups = append(groups, EditionGroup{Edition: edition})
+		}
+		groups[i].Results = append(groups[i].Results, result)
+	}
+	return groups
+}
+
+func editionOf(r Result) string {
+	if r.Edition != "" {
+		return r.Edition
+	}
+	return parse.ParseEdition(r.Name)
+}
+
+// TagEditions sets the Edition of results that don't have one yet.
+func TagEditions(results []Result) {
+	for i := range results {
+		results[i].Edition = editionOf(results[i])
+	}
+}
+
+type editionsKey struct{}
+
+// WithEditions marks editions, like "Director's Cut", as wanted for find
+// calls using ctx. Title searching providers add searches for them, as
+// IMDb ID searches rarely find special cuts.
+func WithEditions(ctx context.Context, editions ...string) context.Context {
+	return context.WithValue(ctx, editionsKey{}, editions)
+}
+
+func EditionsFrom(ctx context.Context) []string {
+	editions, _ := ctx.Value(editionsKey{}).([]string)
+	return editions
+}
+
+// EditionQueries returns the supplementary search strings for editions of
+// a movie, e.g. "Blade Runner 1982 Final Cut". The theatrical edition is
+// what plain searches find, so it gets none.
+func EditionQueries(title string, year int, editions []string) []string {
+	var queries []string
+	for _, edition := range editions {
+		if edition == "" || strings.EqualFold(edition, parse.EditionTheatrical) {
+			continue
+		}
+		query := parse.SanitizeTitle(title)
+		if year > 0 {
+			query += fmt.Sprintf(" %v", year)
+		}
+		queries = append(queries, query+" "+edition)
+	}
+	return queries
+}
+
+// FindMovieEdition finds the given editions of a movie only, searching
+// for them explicitly where providers support it. Like FindMovie, it
+// returns partial results with the failures.
+func (t *Torrent) FindMovieEdition(ctx context.Context, imdbID string, editions ...string) ([]Result, error) {
+	results, err := t.FindMovie(WithEditions(ctx, editions...), imdbID)
+	var kept []Result
+	for _, result := range results {
+		for _, edition := range editions {
+			if strings.EqualFold(result.Edition, edition) {
+				kept = append(kept, result)
+				break
+			}
+		}
+	}
+	return kept, err
+}
@@ -0,0 +1,146 @@
+package torrent
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Decoder decompresses a response body with a content encoding.
+type Decoder func(body io.Reader) (io.ReadCloser, error)
+
+var (
+	decoders = map[string]Decoder{
+		"gzip": func(body io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(body)
+		},
+		"deflate": zlib.NewReader,
+		"br": func(body io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(body)), nil
+		},
+	}
+	decodersLock = &sync.RWMutex{}
+)
+
+// RegisterDecoder adds a content encoding that providers request and
+// decode, e.g. "zstd" with a zstd reader. gzip, deflate and br (brotli)
+// are built in.
+func RegisterDecoder(encoding string, decoder Decoder) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+	decoders[strings.ToLower(encoding)] = decoder
+}
+
+func acceptEncoding() string {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+	encodings := make([]string, 0, len(decoders))
+	for encoding := range decoders {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+	return strings.Join(encodings, ", ")
+}
+
+func decoder(encoding string) (Decoder, bool) {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+	d, ok := decoders[strings.ToLower(strings.TrimSpace(encoding))]
+	return d, ok
+}
+
+// decodingTransport asks for compressed responses and decodes them, so
+// large listing pages cost less bandwidth.
+type decodingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *decodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" {
+		res, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return limitBody(req, res), nil
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", acceptEncoding())
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := res.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return limitBody(req, res), nil
+	}
+	decode, ok := decoder(encoding)
+	if !ok {
+		return limitBody(req, res), nil
+	}
+
+	body, err := decode(res.Body)
+	if err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+	res.Body = &decodedBody{ReadCloser: body, raw: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return limitBody(req, res), nil
+}
+
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if rawErr := b.raw.Close(); err == nil {
+		err = rawErr
+	}
+	return err
+}
+
+// maxBodySize is the number of bytes decoded from a provider response,
+// which ResourceOptions.MaxBodySize can lower further. Larger responses are
+// cut off and fail to decode, so a broken upstream can't exhaust memory.
+const maxBodySize = 32 << 20
+
+// decodeJSON decodes a response body as it streams in, instead of reading
+// it into memory first.
+func decodeJSON(body io.Reader, v interface{}) error {
+	return json.NewDecoder(io.LimitReader(body, maxBodySize)).Decode(v)
+}
+
+// decodeXML is decodeJSON for XML.
+func decodeXML(body io.Reader, v interface{}) error {
+	return xml.NewDecoder(io.LimitReader(body, maxBodySize)).Decode(v)
+}
+
+// jsonInt is a number that some APIs send as JSON string. Like missing
+// values, invalid numbers are 0.
+type jsonInt int
+
+func (i *jsonInt) UnmarshalJSON(data []byte) error {
+	f, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		f = 0
+	}
+	*i = jsonInt(f)
+	return nil
+}
@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jelliflix/imdb/parse"
+)
+
+// matchEpisode reports whether a release name belongs to the wanted episode.
+// Names without any numbering are kept, since they can't be ruled out.
+// In tolerant mode a numbering mismatch is forgiven when the name carries
+// the episode title, which covers specials (E00) and double-length episodes
+// that metadata providers and trackers number differently.
+func matchEpisode(name string, season, episode int, episodeTitle string, tolerant bool) bool {
+	release := parse.ParseRelease(name)
+	if release.Season == 0 && len(release.Episodes) == 0 {
+		return true
+	}
+	if release.HasEpisode(season, episode) {
+		return true
+	}
+	if len(release.Episodes) == 0 && release.Season == season {
+		return true
+	}
+	if !tolerant || episodeTitle == "" {
+		return false
+	}
+
+	title := parse.NormalizeTitle(episodeTitle)
+	return title != "" && strings.Contains(" "+parse.NormalizeTitle(name)+" ", " "+title+" ")
+}
+
+// filterSeasonPacks keeps complete season releases of the given season.
+func filterSeasonPacks(results []Result, season int) []Result {
+	var filtered []Result
+	for _, result := range results {
+		release := parse.ParseRelease(result.Name)
+		if release.Season == season && len(release.Episodes) == 0 {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// episodeTitle returns the title of an episode, or "" if metaGetter can't
+// list seasons or doesn't know the episode.
+func episodeTitle(ctx context.Context, metaGetter MetaGetter, imdbID string, season, episode int) string {
+	seasons, ok := metaGetter.(SeasonGetter)
+	if !ok {
+		return ""
+	}
+	episodes, err := seasons.GetSeason(ctx, imdbID, season)
+	if err != nil {
+		return ""
+	}
+	for _, e := range episodes {
+		if e.Episode == episode {
+			return e.Title
+		}
+	}
+	return ""
+}
+
+func filterEpisode(results []Result, season, episode int, episodeTitle string, tolerant bool) []Result {
+	var filtered []Result
+	for _, result := range results {
+		if matchEpisode(result.Name, season, episode, episodeTitle, tolerant) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
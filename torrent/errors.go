@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrTimeout is the error of providers that didn't answer in time.
+var ErrTimeout = errors.New("timed out")
+
+// ProviderError is the failure of one provider in a lookup.
+type ProviderError struct {
+	Provider string
+	// Reason is one of the Reason constants.
+	Reason string
+	Err    error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Provider + ": " + e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError lists the failures of the providers of one lookup, so
+// errors.Is and errors.As see every one of them. Unwrap returns them in the
+// way errors.Join does; Is and As do the same for Go before 1.20, whose
+// errors package doesn't unwrap lists.
+type MultiError struct {
+	Errors []*ProviderError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnsupported is the error of searches a provider doesn't support at all,
+// e.g. episode searches on a movie-only indexer.
+var ErrUnsupported = errors.New("search not supported")
@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Subscriber receives the events of lookups, e.g. to export metrics.
+// Subscribers are called synchronously by the goroutine doing the lookup,
+// so they must be fast and safe for concurrent use. RequestID(ctx) tells
+// which lookup an event belongs to.
+type Subscriber func(ctx context.Context, event TraceEvent)
+
+// eventBus holds the subscribers of a Torrent.
+type eventBus struct {
+	subscribers map[int]Subscriber
+	next        int
+	lock        *sync.RWMutex
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: map[int]Subscriber{}, lock: &sync.RWMutex{}}
+}
+
+func (b *eventBus) subscribe(s Subscriber) func() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = s
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+func (b *eventBus) publish(ctx context.Context, event TraceEvent) {
+	b.lock.RLock()
+	subs := make([]Subscriber, 0, len(b.subscribers))
+	for _, s := range b.subscribers {
+		subs = append(subs, s)
+	}
+	b.lock.RUnlock()
+
+	for _, s := range subs {
+		s(ctx, event)
+	}
+}
+
+type busKey struct{}
+
+// withBus makes lookups using ctx publish their events on b too, in
+// addition to the buses of enclosing lookups.
+func withBus(ctx context.Context, b *eventBus) context.Context {
+	buses := busesFrom(ctx)
+	for _, bus := range buses {
+		if bus == b {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, busKey{}, append(buses[:len(buses):len(buses)], b))
+}
+
+func busesFrom(ctx context.Context) []*eventBus {
+	buses, _ := ctx.Value(busKey{}).([]*eventBus)
+	return buses
+}
+
+// Subscribe adds a subscriber to the events of the lookups of t, which are
+// the events that TraceCollector records. Events of providers used outside
+// of t aren't delivered. The returned function removes the subscriber
+// again.
+func (t *Torrent) Subscribe(s Subscriber) (unsubscribe func()) {
+	return t.events.subscribe(s)
+}
+
+// publish delivers event to the subscribers and the trace collector of
+// ctx, if any.
+func publish(ctx context.Context, event TraceEvent) {
+	event.Time = time.Now()
+	for _, b := range busesFrom(ctx) {
+		b.publish(ctx, event)
+	}
+	if c := traceFrom(ctx); c != nil {
+		c.add(event)
+	}
+}
@@ -0,0 +1,157 @@
+package torrent
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type FailureCacheOptions struct {
+	BaseTTL time.Duration
+	MaxTTL  time.Duration
+	// Threshold is the number of consecutive failures after which a lookup
+	// is skipped, so a single hiccup doesn't block a provider. Values below
+	// 1 mean DefaultFailureCacheOpts.Threshold.
+	Threshold int
+	// Clock is the time source of the TTLs, SystemClock if nil.
+	Clock Clock
+}
+
+var DefaultFailureCacheOpts = FailureCacheOptions{
+	BaseTTL:   time.Minute,
+	MaxTTL:    6 * time.Hour,
+	Threshold: 3,
+}
+
+// Failure is a provider lookup that keeps failing. Once it failed Threshold
+// times, it is skipped until Until, which moves further out with every
+// further failure.
+type Failure struct {
+	Provider  string    `json:"provider"`
+	Key       string    `json:"key"`
+	Count     int       `json:"count"`
+	LastError string    `json:"lastError"`
+	Until     time.Time `json:"until"`
+}
+
+// FailureCache remembers failing provider lookups with escalating TTLs, so
+// known-bad lookups aren't retried on every request. A failure is kept for
+// MaxTTL after it expires, so failing again escalates the TTL, and dropped
+// after that.
+type FailureCache struct {
+	opts     FailureCacheOptions
+	clock    Clock
+	failures map[string]Failure
+	lock     *sync.Mutex
+}
+
+func NewFailureCache(opts FailureCacheOptions) *FailureCache {
+	if opts.Threshold < 1 {
+		opts.Threshold = DefaultFailureCacheOpts.Threshold
+	}
+	return &FailureCache{
+		opts:     opts,
+		clock:    clockOr(opts.Clock),
+		failures: map[string]Failure{},
+		lock:     &sync.Mutex{},
+	}
+}
+
+func failureKey(provider, key string) string {
+	return provider + "\x00" + key
+}
+
+// Blocked returns the failure of a lookup which must not be retried yet.
+func (c *FailureCache) Blocked(provider, key string) (Failure, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	k := failureKey(provider, key)
+	failure, ok := c.failures[k]
+	now := c.clock.Now()
+	if !ok || failure.Count < c.opts.Threshold || now.After(failure.Until) {
+		if ok && c.stale(failure, now) {
+			delete(c.failures, k)
+		}
+		return Failure{}, false
+	}
+	return failure, true
+}
+
+// stale reports whether a failure expired more than MaxTTL ago. Callers
+// hold the lock.
+func (c *FailureCache) stale(failure Failure, now time.Time) bool {
+	return now.Sub(failure.Until) > c.opts.MaxTTL
+}
+
+// Fail records a failed lookup. From the Threshold-th failure on, the
+// lookup is blocked for BaseTTL, doubled with every further failure up to
+// MaxTTL.
+func (c *FailureCache) Fail(provider, key string, err error) Failure {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.clock.Now()
+	for k, failure := range c.failures {
+		if c.stale(failure, now) {
+			delete(c.failures, k)
+		}
+	}
+
+	k := failureKey(provider, key)
+	failure := c.failures[k]
+	failure.Provider, failure.Key = provider, key
+	failure.Count++
+	failure.LastError = err.Error()
+
+	// Failures below the threshold aren't blocked, but are kept for MaxTTL
+	// to count further ones.
+	failure.Until = now
+	if failure.Count >= c.opts.Threshold {
+		ttl := c.opts.BaseTTL
+		for i := c.opts.Threshold; i < failure.Count && ttl < c.opts.MaxTTL; i++ {
+			ttl *= 2
+		}
+		if ttl > c.opts.MaxTTL {
+			ttl = c.opts.MaxTTL
+		}
+		failure.Until = now.Add(ttl)
+	}
+
+	c.failures[k] = failure
+	return failure
+}
+
+// Succeed forgets the failures of a lookup.
+func (c *FailureCache) Succeed(provider, key string) {
+	c.Reset(provider, key)
+}
+
+func (c *FailureCache) Reset(provider, key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.failures, failureKey(provider, key))
+}
+
+func (c *FailureCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failures = map[string]Failure{}
+}
+
+// Failures lists all recorded failures by provider and key.
+func (c *FailureCache) Failures() []Failure {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	failures := make([]Failure, 0, len(c.failures))
+	for _, failure := range c.failures {
+		failures = append(failures, failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Provider != failures[j].Provider {
+			return failures[i].Provider < failures[j].Provider
+		}
+		return failures[i].Key < failures[j].Key
+	})
+	return failures
+}
@@ -0,0 +1,218 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/parse"
+)
+
+// Selection is a result a user picked for a query, e.g. an IMDb ID.
+type Selection struct {
+	Query  string
+	Result Result
+	Time   time.Time
+}
+
+// FeedbackStore persists selections.
+type FeedbackStore interface {
+	AddSelection(ctx context.Context, selection Selection) error
+	Selections(ctx context.Context) ([]Selection, error)
+}
+
+var (
+	_ FeedbackStore = (*MemFeedbackStore)(nil)
+	_ FeedbackStore = (*FileFeedbackStore)(nil)
+)
+
+type MemFeedbackStore struct {
+	selections []Selection
+	lock       *sync.Mutex
+}
+
+func NewMemFeedbackStore() *MemFeedbackStore {
+	return &MemFeedbackStore{lock: &sync.Mutex{}}
+}
+
+func (s *MemFeedbackStore) AddSelection(_ context.Context, selection Selection) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.selections = append(s.selections, selection)
+	return nil
+}
+
+func (s *MemFeedbackStore) Selections(_ context.Context) ([]Selection, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Selection(nil), s.selections...), nil
+}
+
+// FileFeedbackStore appends selections to a JSON lines file.
+type FileFeedbackStore struct {
+	path string
+	lock *sync.Mutex
+}
+
+func NewFileFeedbackStore(path string) *FileFeedbackStore {
+	return &FileFeedbackStore{path: path, lock: &sync.Mutex{}}
+}
+
+func (s *FileFeedbackStore) AddSelection(_ context.Context, selection Selection) error {
+	line, err := json.Marshal(selection)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("couldn't open feedback file: %v", err)
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("couldn't write feedback file: %v", err)
+	}
+	return f.Close()
+}
+
+func (s *FileFeedbackStore) Selections(_ context.Context) ([]Selection, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't open feedback file: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var selections []Selection
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var selection Selection
+		// Skip lines torn by a crash during a write.
+		if json.Unmarshal(scanner.Bytes(), &selection) == nil {
+			selections = append(selections, selection)
+		}
+	}
+	return selections, scanner.Err()
+}
+
+type RankerOptions struct {
+	// Weight is the bonus in score points of a feature that every
+	// selection had. One resolution step is worth 1000 points.
+	Weight float64
+	// Prior is the number of selections needed for features to reach
+	// half their weight, so a few picks don't swing the ranking.
+	Prior int
+}
+
+var DefaultRankerOpts = RankerOptions{
+	Weight: 500,
+	Prior:  10,
+}
+
+// Ranker adjusts Score with what users of a deployment actually pick. It
+// learns how often chosen results had features like resolution, provider,
+// edition or codec, and boosts results sharing them.
+type Ranker struct {
+	opts   RankerOptions
+	store  FeedbackStore
+	counts map[string]int
+	total  int
+	lock   *sync.RWMutex
+}
+
+// NewRanker creates a ranker which learns from the selections in store.
+func NewRanker(ctx context.Context, opts RankerOptions, store FeedbackStore) (*Ranker, error) {
+	r := &Ranker{
+		opts:   opts,
+		store:  store,
+		counts: map[string]int{},
+		lock:   &sync.RWMutex{},
+	}
+
+	selections, err := store.Selections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load selections: %v", err)
+	}
+	for _, selection := range selections {
+		r.learn(selection.Result)
+	}
+
+	return r, nil
+}
+
+// RecordSelection stores that chosen was picked for query and learns from it.
+func (r *Ranker) RecordSelection(ctx context.Context, query string, chosen Result) error {
+	if err := r.store.AddSelection(ctx, Selection{Query: query, Result: chosen, Time: time.Now()}); err != nil {
+		return fmt.Errorf("couldn't record selection: %v", err)
+	}
+	r.learn(chosen)
+	return nil
+}
+
+func (r *Ranker) learn(result Result) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.total++
+	for _, feature := range resultFeatures(result) {
+		r.counts[feature]++
+	}
+}
+
+// Score is Score plus the learned bonus of result.
+func (r *Ranker) Score(result Result) int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	bonus := 0.0
+	if r.total > 0 {
+		for _, feature := range resultFeatures(result) {
+			bonus += r.opts.Weight * float64(r.counts[feature]) / float64(r.total+r.opts.Prior)
+		}
+	}
+	return Score(result) + int(bonus)
+}
+
+// Stage orders results from best to worst by the learned score, for use as
+// the score stage of a pipeline.
+func (r *Ranker) Stage(_ context.Context, results []Result) ([]Result, error) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return r.Score(results[i]) > r.Score(results[j])
+	})
+	return results, nil
+}
+
+func resultFeatures(result Result) []string {
+	name := strings.ToLower(result.Name)
+	release := parse.ParseRelease(result.Name)
+	features := []string{
+		"provider:" + result.Provider,
+		"edition:" + release.Edition,
+	}
+	if fields := strings.Fields(result.Quality); len(fields) > 0 {
+		features = append(features, "resolution:"+fields[0])
+	}
+	if strings.Contains(result.Quality, "10bit") {
+		features = append(features, "10bit")
+	}
+	if strings.Contains(name, "x265") || strings.Contains(name, "hevc") {
+		features = append(features, "hevc")
+	}
+	if strings.Contains(name, "hdr") {
+		features = append(features, "hdr")
+	}
+	return features
+}
@@ -0,0 +1,401 @@
+package torrent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompileFilter parses a filter expression into a function keeping the
+// results it matches, for use with FilterStage. Expressions combine
+// comparisons of result fields with &&, || and !, e.g.
+//
+//	seeders >= 20 && quality in ["1080p", "2160p"] && !name.contains("HDCAM")
+//
+// Fields are name, title, provider, edition, quality (the resolution, like
+// "1080p"), seeders, size (in bytes) and fuzzy. Strings compare with ==, !=
+// and in, and have the methods contains, startsWith and endsWith, which
+// ignore case. Numbers compare with ==, !=, in, <, <=, > and >=. Lists hold
+// string or number literals of the type of the value compared with them.
+func CompileFilter(expr string) (func(Result) bool, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %v", p.peek().text, p.peek().pos)
+	}
+	if n.typ != typeBool {
+		return nil, fmt.Errorf("filter must be a condition, not a %v", n.typ)
+	}
+	return func(r Result) bool { return n.eval(r).(bool) }, nil
+}
+
+// FilterExprStage is FilterStage with a filter expression, see
+// CompileFilter.
+func FilterExprStage(expr string) (Stage, error) {
+	keep, err := CompileFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't compile filter: %v", err)
+	}
+	return FilterStage(keep), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexFilter(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, expr[start:i], start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, expr[start:i], start})
+		case c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			for ; i < len(expr) && expr[i] != '"'; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				sb.WriteByte(expr[i])
+			}
+			if i >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at %v", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %v", c, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of filter", len(expr)}), nil
+}
+
+type valueType string
+
+const (
+	typeBool   valueType = "condition"
+	typeNumber valueType = "number"
+	typeString valueType = "string"
+
+	typeStringList valueType = "list of strings"
+	typeNumberList valueType = "list of numbers"
+)
+
+var listTypes = map[valueType]valueType{typeString: typeStringList, typeNumber: typeNumberList}
+
+type node struct {
+	typ  valueType
+	eval func(Result) interface{}
+}
+
+var filterFields = map[string]node{
+	"name":     {typeString, func(r Result) interface{} { return r.Name }},
+	"title":    {typeString, func(r Result) interface{} { return r.Title }},
+	"provider": {typeString, func(r Result) interface{} { return r.Provider }},
+	"edition":  {typeString, func(r Result) interface{} { return editionOf(r) }},
+	"quality": {typeString, func(r Result) interface{} {
+		if fields := strings.Fields(r.Quality); len(fields) > 0 {
+			return fields[0]
+		}
+		return ""
+	}},
+	"seeders": {typeNumber, func(r Result) interface{} { return float64(r.Seeders) }},
+	"size":    {typeNumber, func(r Result) interface{} { return float64(r.Size) }},
+	"fuzzy":   {typeBool, func(r Result) interface{} { return r.Fuzzy }},
+}
+
+var comparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var stringMethods = map[string]func(s, arg string) bool{
+	"contains":   strings.Contains,
+	"startsWith": strings.HasPrefix,
+	"endsWith":   strings.HasSuffix,
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q, got %q at %v", op, t.text, t.pos)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (node, error) {
+	return p.parseBinary("||", p.parseAnd)
+}
+
+func (p *filterParser) parseAnd() (node, error) {
+	return p.parseBinary("&&", p.parseUnary)
+}
+
+// parseBinary parses operands joined by op, which is && or ||.
+func (p *filterParser) parseBinary(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return node{}, err
+	}
+	for p.accept(op) {
+		right, err := operand()
+		if err != nil {
+			return node{}, err
+		}
+		if left.typ != typeBool || right.typ != typeBool {
+			return node{}, fmt.Errorf("%v needs conditions on both sides", op)
+		}
+		l, r := left, right
+		if op == "||" {
+			left = node{typeBool, func(res Result) interface{} { return l.eval(res).(bool) || r.eval(res).(bool) }}
+		} else {
+			left = node{typeBool, func(res Result) interface{} { return l.eval(res).(bool) && r.eval(res).(bool) }}
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (node, error) {
+	if p.accept("!") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return node{}, err
+		}
+		if n.typ != typeBool {
+			return node{}, fmt.Errorf("! needs a condition, not a %v", n.typ)
+		}
+		return node{typeBool, func(r Result) interface{} { return !n.eval(r).(bool) }}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return node{}, err
+	}
+
+	t := p.peek()
+	op := t.text
+	if !(t.kind == tokOp && comparisons[op] || t.kind == tokIdent && op == "in") {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return node{}, err
+	}
+	return compare(op, left, right, t.pos)
+}
+
+func compare(op string, left, right node, pos int) (node, error) {
+	if op == "in" {
+		if right.typ != typeStringList && right.typ != typeNumberList {
+			return node{}, fmt.Errorf("in needs a list at %v", pos)
+		}
+		if listTypes[left.typ] != right.typ {
+			return node{}, fmt.Errorf("can't look up %v in %v at %v", left.typ, right.typ, pos)
+		}
+		return node{typeBool, func(r Result) interface{} {
+			v := left.eval(r)
+			for _, item := range right.eval(r).([]interface{}) {
+				if item == v {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	}
+
+	if left.typ != right.typ || left.typ == typeStringList || left.typ == typeNumberList {
+		return node{}, fmt.Errorf("can't compare %v with %v at %v", left.typ, right.typ, pos)
+	}
+	if left.typ != typeNumber && op != "==" && op != "!=" {
+		return node{}, fmt.Errorf("%v only compares numbers at %v", op, pos)
+	}
+	return node{typeBool, func(r Result) interface{} {
+		a, b := left.eval(r), right.eval(r)
+		switch op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "<":
+			return a.(float64) < b.(float64)
+		case "<=":
+			return a.(float64) <= b.(float64)
+		case ">":
+			return a.(float64) > b.(float64)
+		default:
+			return a.(float64) >= b.(float64)
+		}
+	}}, nil
+}
+
+func (p *filterParser) parseOperand() (node, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokOp && t.text == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		return n, p.expect(")")
+	case t.kind == tokOp && t.text == "[":
+		return p.parseList()
+	case t.kind == tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return node{}, fmt.Errorf("invalid number %q at %v", t.text, t.pos)
+		}
+		return node{typeNumber, func(Result) interface{} { return f }}, nil
+	case t.kind == tokString:
+		s := t.text
+		return node{typeString, func(Result) interface{} { return s }}, nil
+	case t.kind == tokIdent && (t.text == "true" || t.text == "false"):
+		b := t.text == "true"
+		return node{typeBool, func(Result) interface{} { return b }}, nil
+	case t.kind == tokIdent:
+		field, ok := filterFields[t.text]
+		if !ok {
+			return node{}, fmt.Errorf("unknown field %q at %v", t.text, t.pos)
+		}
+		if p.accept(".") {
+			return p.parseMethod(field)
+		}
+		return field, nil
+	}
+	return node{}, fmt.Errorf("unexpected %q at %v", t.text, t.pos)
+}
+
+// parseList parses the literals of a list, whose opening bracket was
+// consumed.
+func (p *filterParser) parseList() (node, error) {
+	start := p.tokens[p.pos-1].pos
+	var items []interface{}
+	var typ valueType
+	for !p.accept("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return node{}, err
+			}
+		}
+		t := p.next()
+		var item interface{}
+		var itemType valueType
+		switch t.kind {
+		case tokString:
+			item, itemType = t.text, typeString
+		case tokNumber:
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return node{}, fmt.Errorf("invalid number %q at %v", t.text, t.pos)
+			}
+			item, itemType = f, typeNumber
+		default:
+			return node{}, fmt.Errorf("lists only hold string and number literals, got %q at %v", t.text, t.pos)
+		}
+		if typ != "" && itemType != typ {
+			return node{}, fmt.Errorf("lists must be all strings or all numbers at %v", t.pos)
+		}
+		typ = itemType
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return node{}, fmt.Errorf("empty list at %v", start)
+	}
+	return node{listTypes[typ], func(Result) interface{} { return items }}, nil
+}
+
+func (p *filterParser) parseMethod(field node) (node, error) {
+	t := p.next()
+	method, ok := stringMethods[t.text]
+	if t.kind != tokIdent || !ok {
+		return node{}, fmt.Errorf("unknown method %q at %v", t.text, t.pos)
+	}
+	if field.typ != typeString {
+		return node{}, fmt.Errorf("%v needs a string at %v", t.text, t.pos)
+	}
+	if err := p.expect("("); err != nil {
+		return node{}, err
+	}
+	arg := p.next()
+	if arg.kind != tokString {
+		return node{}, fmt.Errorf("%v needs a string argument at %v", t.text, arg.pos)
+	}
+	if err := p.expect(")"); err != nil {
+		return node{}, err
+	}
+	needle := strings.ToLower(arg.text)
+	return node{typeBool, func(r Result) interface{} {
+		return method(strings.ToLower(field.eval(r).(string)), needle)
+	}}, nil
+}
@@ -0,0 +1,83 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+)
+
+// Hooks are called around every HTTP request a provider makes.
+// OnRequest may modify the request before it is sent. The URL passed to
+// OnResponse has credentials redacted. Audit, if set, records every
+// request through AuditSubscriber; its errors are ignored so auditing can't
+// break lookups.
+type Hooks struct {
+	OnRequest  func(provider string, req *http.Request)
+	OnResponse func(provider, url string, status int, duration time.Duration, err error)
+	Audit      AuditSink
+}
+
+type hookTransport struct {
+	provider string
+	hooks    Hooks
+	// audit is the event bus of Hooks.Audit, nil without it.
+	audit *eventBus
+	next  http.RoundTripper
+}
+
+func newHTTPClient(provider string, timeout time.Duration, hooks Hooks) *http.Client {
+	transport := &hookTransport{
+		provider: provider,
+		hooks:    hooks,
+		next:     &decodingTransport{next: http.DefaultTransport},
+	}
+	if hooks.Audit != nil {
+		transport.audit = newEventBus()
+		transport.audit.subscribe(AuditSubscriber(hooks.Audit))
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+		Transport:     transport,
+	}
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hooks.OnRequest != nil {
+		req = req.Clone(req.Context())
+		t.hooks.OnRequest(t.provider, req)
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	ctx := req.Context()
+	if t.audit != nil {
+		ctx = withBus(ctx, t.audit)
+	}
+	traceRequest(ctx, t.provider, req.Method, req.URL.String(), status, duration, err)
+	if t.hooks.OnResponse != nil {
+		t.hooks.OnResponse(t.provider, credentials.RedactURL(req.URL.String()), status, duration, err)
+	}
+
+	return res, err
+}
+
+// requestError describes a failed request without its credentials: the
+// *url.Error of net/http repeats the full URL, query and all, so it is
+// replaced by its cause and the URL is redacted.
+func requestError(action, rawURL string, err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	return fmt.Errorf("couldn't %v %v: %v", action, credentials.RedactURL(rawURL), err)
+}
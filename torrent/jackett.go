@@ -0,0 +1,340 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+	"github.com/jelliflix/imdb/parse"
+	"go.uber.org/zap"
+)
+
+const (
+	jackettMovieCategory = "2000"
+	jackettTVCategory    = "5000"
+)
+
+type JackettOptions struct {
+	BaseURL  string
+	APIKey   string
+	Timeout  time.Duration
+	CacheAge time.Duration
+	CapsAge  time.Duration
+	Hooks    Hooks
+
+	// Clock is the time source of cache and caps ages, SystemClock if nil.
+	Clock Clock
+
+	// Credentials resolves the API key named "jackett" before every
+	// request, overriding APIKey.
+	Credentials credentials.Store
+}
+
+var DefaultJackettOpts = JackettOptions{
+	BaseURL:  "http://localhost:9117",
+	Timeout:  20 * time.Second,
+	CacheAge: 24 * time.Hour,
+	CapsAge:  24 * time.Hour,
+}
+
+var _ Provider = (*Jackett)(nil)
+
+type jackettIndexer struct {
+	ID         string
+	MovieIMDb  bool
+	MovieQuery bool
+	TVQuery    bool
+}
+
+type Jackett struct {
+	baseURL    string
+	apiKey     string
+	creds      credentials.Store
+	httpClient *http.Client
+	cache      Cache
+	cacheAge   time.Duration
+	clock      Clock
+	capsAge    time.Duration
+	metaGetter MetaGetter
+	logger     *zap.Logger
+
+	indexers  []jackettIndexer
+	capsFetch time.Time
+	lock      *sync.Mutex
+}
+
+// NewJackett searches all configured Jackett indexers through the aggregate
+// "all" endpoint. Results are attributed to the indexer that returned them.
+func NewJackett(opts JackettOptions, cache Cache, metaGetter MetaGetter, logger *zap.Logger) *Jackett {
+	return &Jackett{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		apiKey:     opts.APIKey,
+		creds:      opts.Credentials,
+		httpClient: newHTTPClient("Jackett", opts.Timeout, opts.Hooks),
+		cache:      cache,
+		cacheAge:   opts.CacheAge,
+		clock:      clockOr(opts.Clock),
+		capsAge:    opts.CapsAge,
+		metaGetter: metaGetter,
+		logger:     logger,
+		lock:       &sync.Mutex{},
+	}
+}
+
+func (c *Jackett) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	indexers, err := c.getIndexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var imdbTrackers, queryTrackers []string
+	for _, indexer := range indexers {
+		if indexer.MovieIMDb {
+			imdbTrackers = append(imdbTrackers, indexer.ID)
+		} else if indexer.MovieQuery {
+			queryTrackers = append(queryTrackers, indexer.ID)
+		}
+	}
+
+	var results []Result
+	if len(imdbTrackers) > 0 {
+		res, err := c.find(ctx, CacheKey{ID: imdbID}, imdbID, jackettMovieCategory, imdbTrackers)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+
+	if len(queryTrackers) > 0 {
+		m, err := c.metaGetter.GetMovie(ctx, imdbID)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get movie title for IMDb ID %v: %v", imdbID, err)
+		}
+		query := parse.SanitizeTitle(m.Title)
+		if m.Year > 0 {
+			query += " " + strconv.Itoa(m.Year)
+		}
+		res, err := c.find(ctx, CacheKey{ID: imdbID}, query, jackettMovieCategory, queryTrackers)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+
+	return results, nil
+}
+
+func (c *Jackett) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+	indexers, err := c.getIndexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var trackers []string
+	for _, indexer := range indexers {
+		if indexer.TVQuery {
+			trackers = append(trackers, indexer.ID)
+		}
+	}
+	if len(trackers) == 0 {
+		return nil, nil
+	}
+
+	query, err := createSeriesSearch(ctx, c.metaGetter, imdbID, season, episode)
+	if err != nil {
+		return nil, err
+	}
+
+	key := CacheKey{ID: imdbID, Season: season, Episode: episode}
+	results, err := c.find(ctx, key, query, jackettTVCategory, trackers)
+	if err != nil {
+		return nil, err
+	}
+	return filterEpisode(results, season, episode, "", false), nil
+}
+
+func (c *Jackett) find(ctx context.Context, key CacheKey, query, category string, trackers []string) ([]Result, error) {
+	key.Provider = "Jackett"
+	key.Query = query
+	key.Params = url.Values{"cat": {category}, "tracker": trackers}
+	cacheKey := key.String()
+	torrentList, created, found, err := c.cache.Get(cacheKey)
+	if err != nil {
+		ContextLogger(ctx, c.logger).Error("couldn't get torrent results from cache", zap.Error(err))
+	}
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, "Jackett", cacheKey, found, hit)
+	if hit {
+		return torrentList, nil
+	}
+
+	params := url.Values{}
+	params.Add("Query", query)
+	params.Add("Category[]", category)
+	for _, tracker := range trackers {
+		params.Add("Tracker[]", tracker)
+	}
+
+	var v struct {
+		Results []struct {
+			Tracker   string
+			TrackerID string `json:"TrackerId"`
+			Title     string
+			Size      int
+			Seeders   int
+			MagnetURI string `json:"MagnetUri"`
+			InfoHash  string
+		}
+	}
+	if err = c.get(ctx, "/api/v2.0/indexers/all/results?"+params.Encode(), &v, decodeJSON); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, torrent := range v.Results {
+		name := cleanName(torrent.Title)
+		quality := qualityFromName(name)
+		if quality == "" {
+			continue
+		}
+
+		infoHash := normalizeInfoHash(torrent.InfoHash)
+		if infoHash == "" {
+			infoHash = infoHashFromMagnet(torrent.MagnetURI)
+		}
+		if infoHash == "" {
+			continue
+		}
+
+		magnetURL := torrent.MagnetURI
+		if magnetURL == "" {
+			magnetURL = createMagnetURL(ctx, infoHash, name, nil)
+		}
+
+		provider := torrent.Tracker
+		if provider == "" {
+			provider = torrent.TrackerID
+		}
+
+		results = append(results, Result{
+			Name:      name,
+			Quality:   quality,
+			InfoHash:  infoHash,
+			MagnetURL: magnetURL,
+			Provider:  provider,
+			Size:      torrent.Size,
+			Seeders:   torrent.Seeders,
+		})
+	}
+
+	storeResults(ctx, c.cache, c.logger, "Jackett", cacheKey, results)
+
+	return results, nil
+}
+
+// getIndexers returns the configured indexers with their search capabilities,
+// refreshed every CapsAge.
+func (c *Jackett) getIndexers(ctx context.Context) ([]jackettIndexer, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.indexers != nil && c.clock.Now().Sub(c.capsFetch) <= c.capsAge {
+		return c.indexers, nil
+	}
+
+	params := url.Values{}
+	params.Add("t", "indexers")
+	params.Add("configured", "true")
+
+	type search struct {
+		Available       string `xml:"available,attr"`
+		SupportedParams string `xml:"supportedParams,attr"`
+	}
+	var v struct {
+		Indexers []struct {
+			ID        string `xml:"id,attr"`
+			Searching struct {
+				Search      search `xml:"search"`
+				TVSearch    search `xml:"tv-search"`
+				MovieSearch search `xml:"movie-search"`
+			} `xml:"caps>searching"`
+		} `xml:"indexer"`
+	}
+	if err := c.get(ctx, "/api/v2.0/indexers/all/results/torznab/api?"+params.Encode(), &v, decodeXML); err != nil {
+		return nil, fmt.Errorf("couldn't get indexer capabilities: %v", err)
+	}
+
+	indexers := []jackettIndexer{}
+	for _, indexer := range v.Indexers {
+		searching := indexer.Searching
+		movie := searching.MovieSearch.Available == "yes"
+		indexers = append(indexers, jackettIndexer{
+			ID:         indexer.ID,
+			MovieIMDb:  movie && hasParam(searching.MovieSearch.SupportedParams, "imdbid"),
+			MovieQuery: movie || searching.Search.Available == "yes",
+			TVQuery:    searching.TVSearch.Available == "yes" || searching.Search.Available == "yes",
+		})
+	}
+
+	c.indexers = indexers
+	c.capsFetch = c.clock.Now()
+
+	return indexers, nil
+}
+
+// get requests path and decodes the response into v with decode.
+func (c *Jackett) get(ctx context.Context, path string, v interface{}, decode func(io.Reader, interface{}) error) error {
+	apiKey, err := credentials.Resolve(ctx, c.creds, "jackett", c.apiKey)
+	if err != nil {
+		return err
+	}
+	reqURL := c.baseURL + path + "&apikey=" + url.QueryEscape(apiKey)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return requestError("create request for", reqURL, err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError("GET", reqURL, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad GET response: %v", res.StatusCode)
+	}
+	if err = decode(res.Body, v); err != nil {
+		return fmt.Errorf("couldn't decode response: %v", err)
+	}
+	return nil
+}
+
+func hasParam(supportedParams, param string) bool {
+	for _, p := range strings.Split(supportedParams, ",") {
+		if strings.EqualFold(strings.TrimSpace(p), param) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Jackett) Capabilities() Capabilities {
+	return Capabilities{
+		IMDbSearch:  true,
+		TitleSearch: true,
+		Movies:      true,
+		Episodes:    true,
+		Categories:  []string{jackettMovieCategory, jackettTVCategory},
+	}
+}
+
+func (c *Jackett) Name() string {
+	return "Jackett"
+}
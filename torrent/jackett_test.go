@@ -0,0 +1,50 @@
+package torrent_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func TestJackettConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("apikey") != "key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/torznab/api") {
+			fmt.Fprint(w, `<indexers><indexer id="test"><caps><searching>
+				<search available="yes" supportedParams="q"/>
+				<tv-search available="yes" supportedParams="q,season,ep"/>
+				<movie-search available="yes" supportedParams="q,imdbid"/>
+			</searching></caps></indexer></indexers>`)
+			return
+		}
+		switch query.Get("Query") {
+		case movieID:
+			fmt.Fprint(w, `{"Results":[
+				{"Tracker":"Test","Title":"Big.Buck.Bunny.2008.1080p.BluRay.x264","InfoHash":"0123456789ABCDEF0123456789ABCDEF01234567","Seeders":10,"Size":1000},
+				{"Tracker":"Test","Title":"Big.Buck.Bunny.2008.720p.WEB","MagnetUri":"magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567&dn=bbb"}]}`)
+		case "Pioneer One S01E01":
+			fmt.Fprint(w, `{"Results":[
+				{"Tracker":"Test","Title":"Pioneer.One.S01E01.720p.HDTV.x264","InfoHash":"2123456789abcdef0123456789abcdef01234567","Seeders":5}]}`)
+		default:
+			fmt.Fprint(w, `{"Results":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultJackettOpts
+		opts.BaseURL = server.URL
+		opts.APIKey = "key"
+		return torrent.NewJackett(opts, cache, fakeMeta{}, zap.NewNop())
+	})
+}
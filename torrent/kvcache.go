@@ -0,0 +1,176 @@
+package torrent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrConditionFailed = errors.New("condition failed")
+
+type KVItem struct {
+	Value   []byte
+	Version int64
+	Expires time.Time
+}
+
+// KVStore is the part of a DynamoDB or Firestore client KVCache needs.
+// PutItem must be a conditional write which only succeeds while the stored
+// version equals prevVersion (0 meaning the item must not exist) and
+// returns ErrConditionFailed otherwise. Expires should be mapped to the
+// table's TTL attribute, and left unset when it's zero.
+type KVStore interface {
+	GetItem(ctx context.Context, key string) (item KVItem, found bool, err error)
+	PutItem(ctx context.Context, key string, item KVItem, prevVersion int64) error
+}
+
+// TokenStore is implemented by caches that can share provider tokens,
+// like the RARBG API token, between processes.
+type TokenStore interface {
+	GetToken(key string) (token string, created time.Time, found bool, err error)
+	SetToken(key, token string, ttl time.Duration) error
+}
+
+type KVCacheOptions struct {
+	Prefix string
+	// TTL is how long entries are kept, 0 to keep them until they're
+	// overwritten.
+	TTL time.Duration
+	// Timeout bounds every database call, 0 for no timeout.
+	Timeout time.Duration
+
+	// Clock is the time source of creation and expiry times, SystemClock
+	// if nil.
+	Clock Clock
+}
+
+var DefaultKVCacheOpts = KVCacheOptions{
+	Prefix:  "imdb/",
+	TTL:     24 * time.Hour,
+	Timeout: 5 * time.Second,
+}
+
+var (
+	_ Cache      = (*KVCache)(nil)
+	_ TokenStore = (*KVCache)(nil)
+)
+
+// KVCache persists entries in a key-value cloud database, so stateless
+// functions can share cached results and provider tokens.
+type KVCache struct {
+	store KVStore
+	opts  KVCacheOptions
+	clock Clock
+}
+
+func NewKVCache(opts KVCacheOptions, store KVStore) *KVCache {
+	return &KVCache{store: store, opts: opts, clock: clockOr(opts.Clock)}
+}
+
+func (c *KVCache) Set(key string, results []Result) error {
+	item := CacheItem{Results: results, Created: c.clock.Now()}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("couldn't encode cache item: %v", err)
+	}
+	return c.put("torrent/"+key, data, expiry(item.Created, c.opts.TTL))
+}
+
+func (c *KVCache) Get(key string) ([]Result, time.Time, bool, error) {
+	data, found, err := c.get("torrent/" + key)
+	if err != nil || !found {
+		return nil, time.Time{}, false, err
+	}
+
+	var item CacheItem
+	if err = json.Unmarshal(data, &item); err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("couldn't decode cache item: %v", err)
+	}
+
+	return item.Results, item.Created, true, nil
+}
+
+type kvToken struct {
+	Token   string
+	Created time.Time
+}
+
+func (c *KVCache) GetToken(key string) (string, time.Time, bool, error) {
+	data, found, err := c.get("token/" + key)
+	if err != nil || !found {
+		return "", time.Time{}, false, err
+	}
+
+	var token kvToken
+	if err = json.Unmarshal(data, &token); err != nil {
+		return "", time.Time{}, false, fmt.Errorf("couldn't decode token: %v", err)
+	}
+
+	return token.Token, token.Created, true, nil
+}
+
+// SetToken stores a token for ttl, or until it's overwritten if ttl is 0.
+func (c *KVCache) SetToken(key, token string, ttl time.Duration) error {
+	created := c.clock.Now()
+	data, err := json.Marshal(kvToken{Token: token, Created: created})
+	if err != nil {
+		return fmt.Errorf("couldn't encode token: %v", err)
+	}
+	return c.put("token/"+key, data, expiry(created, ttl))
+}
+
+// expiry returns when an item created at created expires after ttl, the
+// zero time for items without a ttl.
+func expiry(created time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return created.Add(ttl)
+}
+
+// timeoutContext returns a context which is done after timeout, or never if
+// timeout isn't positive.
+func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (c *KVCache) get(key string) ([]byte, bool, error) {
+	ctx, cancel := timeoutContext(c.opts.Timeout)
+	defer cancel()
+
+	item, found, err := c.store.GetItem(ctx, c.opts.Prefix+key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	// TTL deletion in DynamoDB and Firestore is lazy.
+	if !item.Expires.IsZero() && c.clock.Now().After(item.Expires) {
+		return nil, false, nil
+	}
+
+	return item.Value, true, nil
+}
+
+// put writes conditionally on the version it read. Losing the race means
+// another instance just stored a fresh value, which is kept.
+func (c *KVCache) put(key string, data []byte, expires time.Time) error {
+	ctx, cancel := timeoutContext(c.opts.Timeout)
+	defer cancel()
+
+	key = c.opts.Prefix + key
+	current, _, err := c.store.GetItem(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	err = c.store.PutItem(ctx, key, KVItem{Value: data, Version: current.Version + 1, Expires: expires}, current.Version)
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+
+	return err
+}
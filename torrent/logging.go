@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID attaches a correlation ID to ctx, which is added to every
+// provider and cache log line of lookups using that context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextLogger returns logger with the request ID of ctx, if any.
+func ContextLogger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+func ensureRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ctx
+	}
+	return WithRequestID(ctx, hex.EncodeToString(b))
+}
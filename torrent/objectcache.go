@@ -0,0 +1,104 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the part of an S3 or GCS bucket client ObjectCache needs.
+// GetObject returns ErrObjectNotFound for missing keys.
+type ObjectStore interface {
+	GetObject(ctx context.Context, key string) (data []byte, metadata map[string]string, err error)
+	PutObject(ctx context.Context, key string, data []byte, metadata map[string]string) error
+}
+
+type ObjectCacheOptions struct {
+	Prefix string
+	TTL    time.Duration
+	// Timeout bounds every bucket call, 0 for no timeout.
+	Timeout time.Duration
+
+	// Clock is the time source of creation and expiry times, SystemClock
+	// if nil.
+	Clock Clock
+}
+
+var DefaultObjectCacheOpts = ObjectCacheOptions{
+	Prefix:  "imdb/torrent/",
+	TTL:     24 * time.Hour,
+	Timeout: 5 * time.Second,
+}
+
+var _ Cache = (*ObjectCache)(nil)
+
+// ObjectCache persists entries as objects in a bucket, for serverless
+// deployments without local disk or long-lived memory. Every object carries
+// "created" and "expires" metadata (RFC 3339) for bucket lifecycle rules;
+// expired objects are treated as missing. The cache key is in the "key"
+// metadata, URL-escaped since metadata must be ASCII.
+type ObjectCache struct {
+	store ObjectStore
+	opts  ObjectCacheOptions
+	clock Clock
+}
+
+func NewObjectCache(opts ObjectCacheOptions, store ObjectStore) *ObjectCache {
+	return &ObjectCache{store: store, opts: opts, clock: clockOr(opts.Clock)}
+}
+
+func (c *ObjectCache) objectKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return c.opts.Prefix + hex.EncodeToString(sum[:])
+}
+
+func (c *ObjectCache) Set(key string, results []Result) error {
+	item := CacheItem{Results: results, Created: c.clock.Now()}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("couldn't encode cache item: %v", err)
+	}
+
+	metadata := map[string]string{
+		"key":     url.QueryEscape(key),
+		"created": item.Created.UTC().Format(time.RFC3339),
+	}
+	if c.opts.TTL > 0 {
+		metadata["expires"] = item.Created.Add(c.opts.TTL).UTC().Format(time.RFC3339)
+	}
+
+	ctx, cancel := timeoutContext(c.opts.Timeout)
+	defer cancel()
+
+	return c.store.PutObject(ctx, c.objectKey(key), data, metadata)
+}
+
+func (c *ObjectCache) Get(key string) ([]Result, time.Time, bool, error) {
+	ctx, cancel := timeoutContext(c.opts.Timeout)
+	defer cancel()
+
+	data, metadata, err := c.store.GetObject(ctx, c.objectKey(key))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, time.Time{}, false, nil
+	} else if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	if expires, err := time.Parse(time.RFC3339, metadata["expires"]); err == nil && c.clock.Now().After(expires) {
+		return nil, time.Time{}, false, nil
+	}
+
+	var item CacheItem
+	if err = json.Unmarshal(data, &item); err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("couldn't decode cache item: %v", err)
+	}
+
+	return item.Results, item.Created, true, nil
+}
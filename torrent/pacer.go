@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pacer spaces the start of calls at least interval apart. Every wait
+// reserves the next free slot under the lock, so concurrent callers can't
+// observe a stale last call and start too early.
+type pacer struct {
+	interval time.Duration
+	clock    Clock
+	next     time.Time
+	lock     *sync.Mutex
+}
+
+func newPacer(interval time.Duration, clock Clock) *pacer {
+	return &pacer{interval: interval, clock: clock, lock: &sync.Mutex{}}
+}
+
+// wait blocks until the caller's slot has come or ctx is done.
+func (p *pacer) wait(ctx context.Context) error {
+	p.lock.Lock()
+	now := p.clock.Now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(p.interval)
+	p.lock.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.clock.After(delay):
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+package torrent
+
+import "context"
+
+// Page selects a window of the results of a find call. A Limit of 0 means
+// no limit.
+type Page struct {
+	Offset int
+	Limit  int
+}
+
+type pageKey struct{}
+
+// WithPage makes find calls using ctx return only the given page of their
+// results. Pages are cut after the pipeline ran, so with a score stage they
+// are stable across calls.
+func WithPage(ctx context.Context, page Page) context.Context {
+	return context.WithValue(ctx, pageKey{}, page)
+}
+
+func PageFrom(ctx context.Context) (Page, bool) {
+	page, ok := ctx.Value(pageKey{}).(Page)
+	return page, ok
+}
+
+// Apply returns the page of results.
+func (p Page) Apply(results []Result) []Result {
+	if p.Offset > 0 {
+		if p.Offset >= len(results) {
+			return nil
+		}
+		results = results[p.Offset:]
+	}
+	if p.Limit > 0 && len(results) > p.Limit {
+		results = results[:p.Limit]
+	}
+	return results
+}
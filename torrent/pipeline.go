@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stage is one step of result post-processing.
+type Stage func(ctx context.Context, results []Result) ([]Result, error)
+
+// Pipeline processes the results fetched from all finders. Stages run in
+// the order parse, validate, filter, dedup, score, limit; nil stages are
+// skipped, so every stage can be replaced or turned off.
+type Pipeline struct {
+	Parse    Stage
+	Validate Stage
+	Filter   Stage
+	Dedup    Stage
+	Score    Stage
+	Limit    Stage
+}
+
+// DefaultPipeline validates info hashes and removes duplicates, keeping the
+// order in which finders returned results.
+var DefaultPipeline = Pipeline{
+	Parse:    ParseStage,
+	Validate: ValidateStage,
+	Dedup:    DedupStage,
+}
+
+func (p Pipeline) Run(ctx context.Context, results []Result) ([]Result, error) {
+	stages := []struct {
+		name  string
+		stage Stage
+	}{
+		{"parse", p.Parse},
+		{"validate", p.Validate},
+		{"filter", p.Filter},
+		{"dedup", p.Dedup},
+		{"score", p.Score},
+		{"limit", p.Limit},
+	}
+
+	var err error
+	for _, s := range stages {
+		if s.stage == nil {
+			continue
+		}
+		in := len(results)
+		if results, err = s.stage(ctx, results); err != nil {
+			return nil, fmt.Errorf("couldn't run %v stage: %v", s.name, err)
+		}
+		traceStage(ctx, s.name, in, len(results))
+	}
+
+	return results, nil
+}
+
+// ParseStage cleans up names and titles, decoding HTML entities and
+// dropping invalid UTF-8, and fills in the quality of results which didn't
+// set one.
+func ParseStage(_ context.Context, results []Result) ([]Result, error) {
+	for i := range results {
+		results[i].Name = cleanName(results[i].Name)
+		results[i].Title = cleanName(results[i].Title)
+		if results[i].Quality == "" {
+			results[i].Quality = qualityFromName(results[i].Name)
+		}
+	}
+	return results, nil
+}
+
+// ValidateStage drops results without a valid info hash and normalizes the
+// remaining hashes.
+func ValidateStage(_ context.Context, results []Result) ([]Result, error) {
+	var valid []Result
+	for _, result := range results {
+		if result.InfoHash = normalizeInfoHash(result.InfoHash); result.InfoHash != "" {
+			valid = append(valid, result)
+		}
+	}
+	return valid, nil
+}
+
+// DedupStage keeps the first result of every info hash.
+func DedupStage(_ context.Context, results []Result) ([]Result, error) {
+	var unique []Result
+	infoHashes := map[string]struct{}{}
+	for _, result := range results {
+		if _, ok := infoHashes[result.InfoHash]; !ok {
+			unique = append(unique, result)
+			infoHashes[result.InfoHash] = struct{}{}
+		}
+	}
+	return unique, nil
+}
+
+// ScoreStage orders results from best to worst by Score.
+func ScoreStage(_ context.Context, results []Result) ([]Result, error) {
+	SortByScore(results)
+	return results, nil
+}
+
+// FilterStage keeps the results keep returns true for.
+func FilterStage(keep func(Result) bool) Stage {
+	return func(_ context.Context, results []Result) ([]Result, error) {
+		var kept []Result
+		for _, result := range results {
+			if keep(result) {
+				kept = append(kept, result)
+			}
+		}
+		return kept, nil
+	}
+}
+
+// LimitStage keeps the first n results. n <= 0 means no limit.
+func LimitStage(n int) Stage {
+	return func(_ context.Context, results []Result) ([]Result, error) {
+		if n > 0 && len(results) > n {
+			results = results[:n]
+		}
+		return results, nil
+	}
+}
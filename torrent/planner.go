@@ -0,0 +1,203 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jelliflix/imdb/meta"
+	"go.uber.org/zap"
+)
+
+type SeasonGetter interface {
+	GetSeason(ctx context.Context, seriesID string, season int) ([]meta.Meta, error)
+}
+
+type PlannerOptions struct {
+	// Parallelism is the number of seasons planned at the same time.
+	Parallelism int
+	// PackOverhead is how much larger than the individual episodes
+	// together a complete pack may be and still be preferred.
+	PackOverhead float64
+	// SeasonBudget is the maximum size in bytes of a season, 0 for no limit.
+	// Within the budget, episodes are greedily upgraded to better qualities.
+	SeasonBudget int
+	// Checkpoints records every lookup of a scan, so a scan that was
+	// interrupted resumes where it left off. The checkpoints of a series
+	// are cleared once a scan completes without failed lookups. Nil
+	// disables checkpoints.
+	Checkpoints CheckpointStore
+}
+
+var DefaultPlannerOpts = PlannerOptions{
+	Parallelism:  2,
+	PackOverhead: 0.25,
+}
+
+type EpisodePlan struct {
+	Episode int
+	Result  Result
+}
+
+// SeasonPlan is either a season pack or a list of episodes. Missing lists
+// episodes without results when no pack is used. OverBudget is set when not
+// even the smallest results fit the season budget.
+type SeasonPlan struct {
+	Season     int
+	Pack       *Result
+	Episodes   []EpisodePlan
+	Missing    []int
+	Size       int
+	OverBudget bool
+}
+
+type Plan struct {
+	IMDbID  string
+	Seasons []SeasonPlan
+	Size    int
+}
+
+// Planner decides per season whether to grab a season pack or individual
+// episodes.
+type Planner struct {
+	opts    PlannerOptions
+	finder  MagnetFinder
+	seasons SeasonGetter
+	logger  *zap.Logger
+}
+
+// NewPlanner creates a planner. Season packs are only considered if finder
+// implements SeasonFinder, like Torrent does.
+func NewPlanner(opts PlannerOptions, finder MagnetFinder, seasons SeasonGetter, logger *zap.Logger) *Planner {
+	return &Planner{
+		opts:    opts,
+		finder:  finder,
+		seasons: seasons,
+		logger:  logger,
+	}
+}
+
+// Plan returns an acquisition plan for the wanted seasons, ordered by season
+// and episode.
+func (p *Planner) Plan(ctx context.Context, imdbID string, seasons []int) (Plan, error) {
+	resume, err := loadResumeState(ctx, p.opts.Checkpoints, imdbID, p.logger)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	parallelism := p.opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	plans := make([]SeasonPlan, len(seasons))
+	errs := make([]error, len(seasons))
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	for i, season := range seasons {
+		wg.Add(1)
+		go func(i, season int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			plans[i], errs[i] = p.planSeason(ctx, resume, imdbID, season)
+		}(i, season)
+	}
+	wg.Wait()
+
+	plan := Plan{IMDbID: imdbID}
+	for i, err := range errs {
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Seasons = append(plan.Seasons, plans[i])
+		plan.Size += plans[i].Size
+	}
+	sort.Slice(plan.Seasons, func(i, j int) bool {
+		return plan.Seasons[i].Season < plan.Seasons[j].Season
+	})
+
+	resume.clear(ctx)
+
+	return plan, nil
+}
+
+func (p *Planner) planSeason(ctx context.Context, resume *resumeState, imdbID string, season int) (SeasonPlan, error) {
+	episodes, err := p.seasons.GetSeason(ctx, imdbID, season)
+	if err != nil {
+		return SeasonPlan{}, fmt.Errorf("couldn't get season %v of %v: %v", season, imdbID, err)
+	}
+
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].Episode < episodes[j].Episode
+	})
+
+	plan := SeasonPlan{Season: season}
+	var found []int
+	var candidates [][]Result
+	for _, episode := range episodes {
+		results, err := resume.lookup(ctx, checkpointKey{season: season, episode: episode.Episode}, func() ([]Result, error) {
+			return p.finder.FindEpisode(ctx, imdbID, season, episode.Episode)
+		})
+		if err != nil {
+			ContextLogger(ctx, p.logger).Error("couldn't find episode", zap.Error(err),
+				zap.String("id", imdbID), zap.Int("season", season), zap.Int("episode", episode.Episode))
+		}
+		if len(results) == 0 {
+			plan.Missing = append(plan.Missing, episode.Episode)
+			continue
+		}
+		found = append(found, episode.Episode)
+		candidates = append(candidates, results)
+	}
+
+	var selected []Result
+	if p.opts.SeasonBudget > 0 && len(candidates) > 0 {
+		var fits bool
+		selected, fits = selectWithin(candidates, p.opts.SeasonBudget)
+		plan.OverBudget = !fits
+	} else {
+		for _, results := range candidates {
+			best, _ := Best(results)
+			selected = append(selected, best)
+		}
+	}
+
+	minResolution := 0
+	for i, result := range selected {
+		plan.Episodes = append(plan.Episodes, EpisodePlan{Episode: found[i], Result: result})
+		plan.Size += result.Size
+		if r := resolutionScore(result); minResolution == 0 || r < minResolution {
+			minResolution = r
+		}
+	}
+
+	seasonFinder, ok := p.finder.(SeasonFinder)
+	if !ok {
+		return plan, nil
+	}
+	packs, err := resume.lookup(ctx, checkpointKey{season: season, pack: true}, func() ([]Result, error) {
+		return seasonFinder.FindSeason(ctx, imdbID, season)
+	})
+	if err != nil {
+		ContextLogger(ctx, p.logger).Error("couldn't find season pack", zap.Error(err),
+			zap.String("id", imdbID), zap.Int("season", season))
+	}
+	pack, ok := Best(packs)
+	if p.opts.SeasonBudget > 0 {
+		pack, ok = BestWithin(packs, p.opts.SeasonBudget)
+	}
+	if !ok {
+		return plan, nil
+	}
+
+	// A pack wins if it fills gaps, or if it isn't worse or much larger than
+	// the episodes it replaces.
+	if len(plan.Missing) > 0 || plan.OverBudget ||
+		(resolutionScore(pack) >= minResolution && float64(pack.Size) <= float64(plan.Size)*(1+p.opts.PackOverhead)) {
+		return SeasonPlan{Season: season, Pack: &pack, Size: pack.Size}, nil
+	}
+
+	return plan, nil
+}
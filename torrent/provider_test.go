@@ -0,0 +1,59 @@
+package torrent_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+)
+
+// The fake upstream servers of the conformance tests know a movie and an
+// episode and answer everything else with no results.
+const (
+	movieID   = "tt1254207"
+	seriesID  = "tt1748166"
+	missingID = "tt0000000"
+)
+
+var finderCases = torrenttest.Cases{
+	Movie:   movieID,
+	Episode: torrenttest.Episode{IMDbID: seriesID, Season: 1, Episode: 1},
+	Missing: missingID,
+}
+
+var (
+	_ torrent.MetaGetter = fakeMeta{}
+	_ torrent.Clock      = instantClock{}
+)
+
+type fakeMeta struct{}
+
+func (fakeMeta) GetMovie(_ context.Context, imdbID string) (meta.Meta, error) {
+	if imdbID == movieID {
+		return meta.Meta{IMDbID: imdbID, Title: "Big Buck Bunny", Year: 2008}, nil
+	}
+	return meta.Meta{IMDbID: imdbID, Title: "Missing Movie", Year: 2000}, nil
+}
+
+func (fakeMeta) GetEpisode(_ context.Context, imdbID string) (meta.Meta, error) {
+	if imdbID == seriesID {
+		return meta.Meta{IMDbID: imdbID, Title: "Pioneer One", Year: 2010}, nil
+	}
+	return meta.Meta{IMDbID: imdbID, Title: "Missing Series", Year: 2000}, nil
+}
+
+// instantClock is the system clock without waits, so paced providers don't
+// slow down the tests.
+type instantClock struct{}
+
+func (instantClock) Now() time.Time {
+	return time.Now()
+}
+
+func (instantClock) After(time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	c <- time.Now()
+	return c
+}
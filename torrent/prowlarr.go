@@ -0,0 +1,486 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+	"github.com/jelliflix/imdb/parse"
+	"go.uber.org/zap"
+)
+
+type ProwlarrOptions struct {
+	BaseURL  string
+	APIKey   string
+	Timeout  time.Duration
+	CacheAge time.Duration
+	// CapsAge is how long the indexers searched by FindMovie and
+	// FindEpisode are kept before they're listed again.
+	CapsAge time.Duration
+	Hooks   Hooks
+
+	// Clock is the time source of cache and caps ages, SystemClock if nil.
+	Clock Clock
+
+	// Credentials resolves the API key named "prowlarr" before every
+	// request, overriding APIKey.
+	Credentials credentials.Store
+}
+
+var DefaultProwlarrOpts = ProwlarrOptions{
+	BaseURL:  "http://localhost:9696",
+	Timeout:  20 * time.Second,
+	CacheAge: 24 * time.Hour,
+	CapsAge:  24 * time.Hour,
+}
+
+type ProwlarrIndexer struct {
+	ID           int
+	Name         string
+	Enabled      bool
+	Protocol     string
+	Capabilities ProwlarrCapabilities
+}
+
+type ProwlarrCapabilities struct {
+	SearchParams      []string
+	TVSearchParams    []string
+	MovieSearchParams []string
+	Categories        []int
+}
+
+func (i ProwlarrIndexer) supports(params []string, param string) bool {
+	for _, p := range params {
+		if strings.EqualFold(p, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProwlarrSearch is a search request. Type is one of "search", "movie" or
+// "tvsearch"; empty IndexerIDs searches all enabled indexers.
+type ProwlarrSearch struct {
+	Query      string
+	Type       string
+	IndexerIDs []int
+	Categories []int
+}
+
+var _ Provider = (*Prowlarr)(nil)
+
+// Prowlarr is a client for Prowlarr's application API. Besides being a
+// MagnetFinder over all enabled indexers, it can list indexers and hand
+// out one finder per indexer.
+type Prowlarr struct {
+	baseURL    string
+	apiKey     string
+	creds      credentials.Store
+	httpClient *http.Client
+	cache      Cache
+	cacheAge   time.Duration
+	clock      Clock
+	capsAge    time.Duration
+	metaGetter MetaGetter
+	logger     *zap.Logger
+
+	indexers  []ProwlarrIndexer
+	capsFetch time.Time
+	lock      *sync.Mutex
+}
+
+func NewProwlarr(opts ProwlarrOptions, cache Cache, metaGetter MetaGetter, logger *zap.Logger) *Prowlarr {
+	return &Prowlarr{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		apiKey:     opts.APIKey,
+		creds:      opts.Credentials,
+		httpClient: newHTTPClient("Prowlarr", opts.Timeout, opts.Hooks),
+		cache:      cache,
+		cacheAge:   opts.CacheAge,
+		clock:      clockOr(opts.Clock),
+		capsAge:    opts.CapsAge,
+		metaGetter: metaGetter,
+		logger:     logger,
+		lock:       &sync.Mutex{},
+	}
+}
+
+func (c *Prowlarr) Capabilities() Capabilities {
+	return Capabilities{
+		IMDbSearch:  true,
+		TitleSearch: true,
+		Movies:      true,
+		Episodes:    true,
+		Categories:  []string{"2000", "5000"},
+	}
+}
+
+func (c *Prowlarr) Name() string {
+	return "Prowlarr"
+}
+
+func (c *Prowlarr) Indexers(ctx context.Context) ([]ProwlarrIndexer, error) {
+	var v []struct {
+		ID           int    `json:"id"`
+		Name         string `json:"name"`
+		Enable       bool   `json:"enable"`
+		Protocol     string `json:"protocol"`
+		Capabilities struct {
+			SearchParams      []string `json:"searchParams"`
+			TVSearchParams    []string `json:"tvSearchParams"`
+			MovieSearchParams []string `json:"movieSearchParams"`
+			Categories        []struct {
+				ID            int `json:"id"`
+				SubCategories []struct {
+					ID int `json:"id"`
+				} `json:"subCategories"`
+			} `json:"categories"`
+		} `json:"capabilities"`
+	}
+	if err := c.get(ctx, "/api/v1/indexer", nil, &v); err != nil {
+		return nil, err
+	}
+
+	var indexers []ProwlarrIndexer
+	for _, i := range v {
+		caps := ProwlarrCapabilities{
+			SearchParams:      i.Capabilities.SearchParams,
+			TVSearchParams:    i.Capabilities.TVSearchParams,
+			MovieSearchParams: i.Capabilities.MovieSearchParams,
+		}
+		for _, cat := range i.Capabilities.Categories {
+			caps.Categories = append(caps.Categories, cat.ID)
+			for _, sub := range cat.SubCategories {
+				caps.Categories = append(caps.Categories, sub.ID)
+			}
+		}
+		indexers = append(indexers, ProwlarrIndexer{
+			ID:           i.ID,
+			Name:         i.Name,
+			Enabled:      i.Enable,
+			Protocol:     i.Protocol,
+			Capabilities: caps,
+		})
+	}
+
+	return indexers, nil
+}
+
+func (c *Prowlarr) Search(ctx context.Context, search ProwlarrSearch) ([]Result, error) {
+	params := url.Values{}
+	params.Add("query", search.Query)
+	if search.Type != "" {
+		params.Add("type", search.Type)
+	}
+	for _, id := range search.IndexerIDs {
+		params.Add("indexerIds", strconv.Itoa(id))
+	}
+	for _, cat := range search.Categories {
+		params.Add("categories", strconv.Itoa(cat))
+	}
+
+	var v []struct {
+		Title     string `json:"title"`
+		Indexer   string `json:"indexer"`
+		Size      int    `json:"size"`
+		Seeders   int    `json:"seeders"`
+		MagnetURL string `json:"magnetUrl"`
+		InfoHash  string `json:"infoHash"`
+		Protocol  string `json:"protocol"`
+	}
+	if err := c.get(ctx, "/api/v1/search", params, &v); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, torrent := range v {
+		if torrent.Protocol != "" && torrent.Protocol != "torrent" {
+			continue
+		}
+		name := cleanName(torrent.Title)
+		quality := qualityFromName(name)
+		if quality == "" {
+			continue
+		}
+		infoHash := normalizeInfoHash(torrent.InfoHash)
+		if infoHash == "" {
+			infoHash = infoHashFromMagnet(torrent.MagnetURL)
+		}
+		if infoHash == "" {
+			continue
+		}
+		magnetURL := torrent.MagnetURL
+		if magnetURL == "" {
+			magnetURL = createMagnetURL(ctx, infoHash, name, nil)
+		}
+		results = append(results, Result{
+			Name:      name,
+			Quality:   quality,
+			InfoHash:  infoHash,
+			MagnetURL: magnetURL,
+			Provider:  torrent.Indexer,
+			Size:      torrent.Size,
+			Seeders:   torrent.Seeders,
+		})
+	}
+
+	return results, nil
+}
+
+// Finders returns one MagnetFinder per enabled torrent indexer, so
+// indexers can be added to an aggregator as individual providers.
+func (c *Prowlarr) Finders(ctx context.Context) ([]MagnetFinder, error) {
+	indexers, err := c.Indexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var finders []MagnetFinder
+	for _, indexer := range indexers {
+		if indexer.Enabled && indexer.Protocol == "torrent" {
+			finders = append(finders, &prowlarrIndexer{client: c, indexer: indexer})
+		}
+	}
+
+	return finders, nil
+}
+
+func (c *Prowlarr) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	indexers, err := c.enabledIndexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.findMovie(ctx, imdbID, indexers)
+}
+
+func (c *Prowlarr) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+	indexers, err := c.enabledIndexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.findEpisode(ctx, imdbID, season, episode, indexers)
+}
+
+// enabledIndexers returns the enabled torrent indexers, refreshed every
+// CapsAge.
+func (c *Prowlarr) enabledIndexers(ctx context.Context) ([]ProwlarrIndexer, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.indexers != nil && c.clock.Now().Sub(c.capsFetch) <= c.capsAge {
+		return c.indexers, nil
+	}
+
+	indexers, err := c.Indexers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enabled := []ProwlarrIndexer{}
+	for _, indexer := range indexers {
+		if indexer.Enabled && indexer.Protocol == "torrent" {
+			enabled = append(enabled, indexer)
+		}
+	}
+
+	c.indexers = enabled
+	c.capsFetch = c.clock.Now()
+	return enabled, nil
+}
+
+func (c *Prowlarr) findMovie(ctx context.Context, imdbID string, indexers []ProwlarrIndexer) ([]Result, error) {
+	var imdbIDs, queryIDs []int
+	for _, indexer := range indexers {
+		if indexer.supports(indexer.Capabilities.MovieSearchParams, "imdbId") {
+			imdbIDs = append(imdbIDs, indexer.ID)
+		} else {
+			queryIDs = append(queryIDs, indexer.ID)
+		}
+	}
+
+	var results []Result
+	if len(imdbIDs) > 0 {
+		res, err := c.cachedSearch(ctx, CacheKey{ID: imdbID}, ProwlarrSearch{
+			Query:      "{ImdbId:" + imdbID + "}",
+			Type:       "movie",
+			IndexerIDs: imdbIDs,
+			Categories: []int{2000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+
+	if len(queryIDs) > 0 {
+		m, err := c.metaGetter.GetMovie(ctx, imdbID)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get movie title for IMDb ID %v: %v", imdbID, err)
+		}
+		query := parse.SanitizeTitle(m.Title)
+		if m.Year > 0 {
+			query += " " + strconv.Itoa(m.Year)
+		}
+		res, err := c.cachedSearch(ctx, CacheKey{ID: imdbID}, ProwlarrSearch{
+			Query:      query,
+			Type:       "search",
+			IndexerIDs: queryIDs,
+			Categories: []int{2000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+
+	return results, nil
+}
+
+func (c *Prowlarr) findEpisode(ctx context.Context, imdbID string, season, episode int, indexers []ProwlarrIndexer) ([]Result, error) {
+	key := CacheKey{ID: imdbID, Season: season, Episode: episode}
+
+	var imdbIDs, queryIDs []int
+	for _, indexer := range indexers {
+		if indexer.supports(indexer.Capabilities.TVSearchParams, "imdbId") {
+			imdbIDs = append(imdbIDs, indexer.ID)
+		} else {
+			queryIDs = append(queryIDs, indexer.ID)
+		}
+	}
+
+	var results []Result
+	if len(imdbIDs) > 0 {
+		res, err := c.cachedSearch(ctx, key, ProwlarrSearch{
+			Query:      fmt.Sprintf("{ImdbId:%v}{Season:%02d}{Episode:%02d}", imdbID, season, episode),
+			Type:       "tvsearch",
+			IndexerIDs: imdbIDs,
+			Categories: []int{5000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+
+	if len(queryIDs) > 0 {
+		query, err := createSeriesSearch(ctx, c.metaGetter, imdbID, season, episode)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.cachedSearch(ctx, key, ProwlarrSearch{
+			Query:      query,
+			Type:       "search",
+			IndexerIDs: queryIDs,
+			Categories: []int{5000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, filterEpisode(res, season, episode, "", false)...)
+	}
+
+	return results, nil
+}
+
+func (c *Prowlarr) cachedSearch(ctx context.Context, key CacheKey, search ProwlarrSearch) ([]Result, error) {
+	key.Provider = "Prowlarr"
+	key.Query = search.Query
+	key.Params = url.Values{"type": {search.Type}}
+	for _, id := range search.IndexerIDs {
+		key.Params.Add("indexer", strconv.Itoa(id))
+	}
+	for _, cat := range search.Categories {
+		key.Params.Add("cat", strconv.Itoa(cat))
+	}
+	cacheKey := key.String()
+	torrentList, created, found, err := c.cache.Get(cacheKey)
+	if err != nil {
+		ContextLogger(ctx, c.logger).Error("couldn't get torrent results from cache", zap.Error(err))
+	}
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, "Prowlarr", cacheKey, found, hit)
+	if hit {
+		return torrentList, nil
+	}
+
+	results, err := c.Search(ctx, search)
+	if err != nil {
+		return nil, err
+	}
+
+	storeResults(ctx, c.cache, c.logger, "Prowlarr", cacheKey, results)
+
+	return results, nil
+}
+
+// get requests path with params and decodes the JSON response into v.
+func (c *Prowlarr) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	reqURL := c.baseURL + path
+	if params != nil {
+		reqURL += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return requestError("create request for", reqURL, err)
+	}
+	apiKey, err := credentials.Resolve(ctx, c.creds, "prowlarr", c.apiKey)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError("GET", reqURL, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad GET response: %v", res.StatusCode)
+	}
+	if err = decodeJSON(res.Body, v); err != nil {
+		return fmt.Errorf("couldn't decode response: %v", err)
+	}
+	return nil
+}
+
+var _ Provider = (*prowlarrIndexer)(nil)
+
+type prowlarrIndexer struct {
+	client  *Prowlarr
+	indexer ProwlarrIndexer
+}
+
+func (c *prowlarrIndexer) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	return c.client.findMovie(ctx, imdbID, []ProwlarrIndexer{c.indexer})
+}
+
+func (c *prowlarrIndexer) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+	return c.client.findEpisode(ctx, imdbID, season, episode, []ProwlarrIndexer{c.indexer})
+}
+
+func (c *prowlarrIndexer) Capabilities() Capabilities {
+	caps := c.indexer.Capabilities
+	categories := make([]string, 0, len(caps.Categories))
+	for _, cat := range caps.Categories {
+		categories = append(categories, strconv.Itoa(cat))
+	}
+	return Capabilities{
+		IMDbSearch:  c.indexer.supports(caps.MovieSearchParams, "imdbId") || c.indexer.supports(caps.TVSearchParams, "imdbId"),
+		TitleSearch: c.indexer.supports(caps.SearchParams, "q"),
+		Movies:      len(caps.MovieSearchParams) > 0 || len(caps.SearchParams) > 0,
+		Episodes:    len(caps.TVSearchParams) > 0 || len(caps.SearchParams) > 0,
+		Categories:  categories,
+	}
+}
+
+func (c *prowlarrIndexer) Name() string {
+	return c.indexer.Name
+}
@@ -0,0 +1,49 @@
+package torrent_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func TestProwlarrConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/v1/indexer" {
+			fmt.Fprint(w, `[
+				{"id":1,"name":"Test","enable":true,"protocol":"torrent","capabilities":{
+					"searchParams":["q"],"tvSearchParams":["q","season","ep","imdbId"],"movieSearchParams":["q","imdbId"],
+					"categories":[{"id":2000,"subCategories":[{"id":2040}]},{"id":5000}]}},
+				{"id":2,"name":"Usenet","enable":true,"protocol":"usenet"}]`)
+			return
+		}
+		switch r.URL.Query().Get("query") {
+		case "{ImdbId:" + movieID + "}":
+			fmt.Fprint(w, `[
+				{"title":"Big.Buck.Bunny.2008.1080p.BluRay.x264","indexer":"Test","infoHash":"0123456789ABCDEF0123456789ABCDEF01234567","seeders":10,"size":1000,"protocol":"torrent"},
+				{"title":"Big.Buck.Bunny.2008.720p.WEB","indexer":"Test","magnetUrl":"magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567&dn=bbb","protocol":"torrent"},
+				{"title":"Big.Buck.Bunny.2008.1080p.NZB","indexer":"Usenet","protocol":"usenet"}]`)
+		case "{ImdbId:" + seriesID + "}{Season:01}{Episode:01}":
+			fmt.Fprint(w, `[
+				{"title":"Pioneer.One.S01E01.720p.HDTV.x264","indexer":"Test","infoHash":"2123456789abcdef0123456789abcdef01234567","seeders":5,"protocol":"torrent"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultProwlarrOpts
+		opts.BaseURL = server.URL
+		opts.APIKey = "key"
+		return torrent.NewProwlarr(opts, cache, fakeMeta{}, zap.NewNop())
+	})
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package torrent_test
+
+// raceEnabled is set with -race, which slows down benchmarks too much for
+// their time budgets.
+const raceEnabled = true
@@ -3,14 +3,13 @@ package torrent
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/tidwall/gjson"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +17,11 @@ type RARBGOptions struct {
 	BaseURL  string
 	Timeout  time.Duration
 	CacheAge time.Duration
+	Hooks    Hooks
+
+	// Clock is the time source of cache ages, token expiry and request
+	// pacing, SystemClock if nil.
+	Clock Clock
 }
 
 var DefaultRARBOpts = RARBGOptions{
@@ -26,43 +30,57 @@ var DefaultRARBOpts = RARBGOptions{
 	CacheAge: 24 * time.Hour,
 }
 
-var _ MagnetFinder = (*rarbg)(nil)
+const (
+	rarbgTokenAge = 14 * time.Minute
+	rarbgInterval = 2 * time.Second
+)
+
+var (
+	_ Provider     = (*RARBG)(nil)
+	_ SeasonFinder = (*RARBG)(nil)
+)
 
-type rarbg struct {
-	baseURL      string
+type RARBG struct {
+	baseURL      *mirror
 	httpClient   *http.Client
 	cache        Cache
+	tokens       TokenStore
 	cacheAge     time.Duration
+	clock        Clock
 	logger       *zap.Logger
+	pacer        *pacer
 	token        string
 	tokenExpired func() bool
-	lastRequest  time.Time
 	lock         *sync.Mutex
 }
 
-func NewRARBG(opts RARBGOptions, cache Cache, logger *zap.Logger) *rarbg {
-	return &rarbg{
-		baseURL: opts.BaseURL,
-		httpClient: &http.Client{
-			Timeout: opts.Timeout,
-		},
+// NewRARBG creates a RARBG finder. If cache is also a TokenStore, the API
+// token is shared through it.
+func NewRARBG(opts RARBGOptions, cache Cache, logger *zap.Logger) *RARBG {
+	tokens, _ := cache.(TokenStore)
+	return &RARBG{
+		baseURL:      newMirror(opts.BaseURL),
+		httpClient:   newHTTPClient("RARBG", opts.Timeout, opts.Hooks),
 		cache:        cache,
+		tokens:       tokens,
 		cacheAge:     opts.CacheAge,
+		clock:        clockOr(opts.Clock),
 		logger:       logger,
+		pacer:        newPacer(rarbgInterval, clockOr(opts.Clock)),
 		tokenExpired: func() bool { return true },
 		lock:         &sync.Mutex{},
 	}
 }
 
-func (c *rarbg) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+func (c *RARBG) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
 	escapedQuery := "search_imdb=" + imdbID
-	return c.find(ctx, imdbID, escapedQuery)
+	key := CacheKey{Provider: "RARBG", ID: imdbID}
+	return c.find(ctx, key, escapedQuery)
 }
 
-func (c *rarbg) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+func (c *RARBG) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
 	seasonString := strconv.Itoa(season)
 	episodeString := strconv.Itoa(episode)
-	id := imdbID + ":" + seasonString + ":" + episodeString
 	if season < 10 {
 		seasonString = "0" + seasonString
 	}
@@ -70,40 +88,49 @@ func (c *rarbg) FindEpisode(ctx context.Context, imdbID string, season, episode
 		episodeString = "0" + episodeString
 	}
 	escapedQuery := "search_imdb=" + imdbID + "&search_string=S" + seasonString + "E" + episodeString
-	return c.find(ctx, id, escapedQuery)
+	key := CacheKey{Provider: "RARBG", ID: imdbID, Season: season, Episode: episode}
+	return c.find(ctx, key, escapedQuery)
 }
 
-func (c *rarbg) find(_ context.Context, id, escapedQuery string) ([]Result, error) {
-	cacheKey := id + "-RARBG"
+func (c *RARBG) FindSeason(ctx context.Context, imdbID string, season int) ([]Result, error) {
+	searchString := fmt.Sprintf("S%02d", season)
+	escapedQuery := "search_imdb=" + imdbID + "&search_string=" + searchString
+	key := CacheKey{Provider: "RARBG", ID: imdbID, Season: season, Query: searchString}
+	results, err := c.find(ctx, key, escapedQuery)
+	if err != nil {
+		return nil, err
+	}
+	return filterSeasonPacks(results, season), nil
+}
+
+func (c *RARBG) find(ctx context.Context, key CacheKey, escapedQuery string) ([]Result, error) {
+	cacheKey := key.String()
 	torrentList, created, found, err := c.cache.Get(cacheKey)
-	if found && time.Since(created) <= (c.cacheAge) {
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, "RARBG", cacheKey, found, hit)
+	if hit {
 		return torrentList, nil
 	}
 
-	if c.tokenExpired() {
-		if err = c.RefreshToken(); err != nil {
-			c.logger.Error("couldn't refresh token", zap.Error(err))
-			return nil, nil
-		}
+	token, err := c.validToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't refresh token: %v", err)
 	}
 
-	c.lock.Lock()
-	time.Sleep(2*time.Second - time.Since(c.lastRequest))
-	defer func() {
-		c.lock.Unlock()
-		c.lastRequest = time.Now()
-	}()
+	if err = c.pacer.wait(ctx); err != nil {
+		return nil, err
+	}
 
-	url := c.baseURL + "/pubapi_v2.php?app_id=deflix&mode=search&sort=seeders&format=json_extended&ranked=0&token=" + c.token + "&" + escapedQuery
-	req, err := http.NewRequest("GET", url, nil)
+	url := c.baseURL.String() + "/pubapi_v2.php?app_id=deflix&mode=search&sort=seeders&format=json_extended&ranked=0&token=" + token + "&" + escapedQuery
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create request: %v", err)
+		return nil, requestError("create request for", url, err)
 	}
 	req.Header.Set("User-Agent", "curl/7.47.0")
 	req.Header.Set("Accept", "*/*")
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't GET %v: %v", url, err)
+		return nil, requestError("GET", url, err)
 	}
 	defer func() {
 		_ = res.Body.Close()
@@ -111,18 +138,27 @@ func (c *rarbg) find(_ context.Context, id, escapedQuery string) ([]Result, erro
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("bad GET response: %v", res.StatusCode)
 	}
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read response body: %v", err)
+	if baseURL, moved := c.baseURL.follow(res); moved {
+		ContextLogger(ctx, c.logger).Info("provider moved to mirror", zap.String("provider", "RARBG"), zap.String("url", baseURL))
 	}
-
-	torrents := gjson.GetBytes(resBody, "torrent_results").Array()
-	if len(torrents) == 0 {
+	var v struct {
+		TorrentResults []struct {
+			Title    string  `json:"title"`
+			Download string  `json:"download"`
+			Size     jsonInt `json:"size"`
+			Seeders  jsonInt `json:"seeders"`
+		} `json:"torrent_results"`
+	}
+	// An empty body has no results, like an error document.
+	if err = decodeJSON(res.Body, &v); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("couldn't decode response: %v", err)
+	}
+	if len(v.TorrentResults) == 0 {
 		return nil, nil
 	}
 	var results []Result
-	for _, torrent := range torrents {
-		filename := torrent.Get("title").String()
+	for _, torrent := range v.TorrentResults {
+		filename := cleanName(torrent.Title)
 
 		quality := ""
 		if strings.Contains(filename, "720p") {
@@ -135,56 +171,79 @@ func (c *rarbg) find(_ context.Context, id, escapedQuery string) ([]Result, erro
 			continue
 		}
 
-		magnet := torrent.Get("download").String()
+		magnet := torrent.Download
 
-		match := magnet2InfoHashRegex.Find([]byte(magnet))
-		infoHash := strings.TrimPrefix(string(match), "btih:")
-		infoHash = strings.TrimSuffix(infoHash, "&")
-		infoHash = strings.ToLower(infoHash)
-		if len(infoHash) != 40 {
+		infoHash := infoHashFromMagnet(magnet)
+		if infoHash == "" {
 			continue
 		}
-		size := int(torrent.Get("size").Int())
-		seeders := int(torrent.Get("seeders").Int())
+		size := int(torrent.Size)
+		seeders := int(torrent.Seeders)
 
 		result := Result{
 			Name:      filename,
 			Quality:   quality,
 			InfoHash:  infoHash,
 			MagnetURL: magnet,
+			Provider:  "RARBG",
 			Size:      size,
 			Seeders:   seeders,
 		}
 		results = append(results, result)
 	}
 
-	if err := c.cache.Set(cacheKey, results); err != nil {
-		c.logger.Error("couldn't cache torrents", zap.Error(err), zap.String("cache", "torrent"))
-	}
+	storeResults(ctx, c.cache, c.logger, "RARBG", cacheKey, results)
 
 	return results, nil
 }
 
-func (c *rarbg) RefreshToken() error {
-	url := c.baseURL + "/pubapi_v2.php?app_id=deflix&get_token=get_token"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("couldn't create request object: %v", req)
-	}
+func (c *RARBG) RefreshToken() error {
+	_, err := c.validToken(context.Background())
+	return err
+}
 
+// validToken returns the current token, refreshing it first if it expired.
+// The lock is held during the refresh, so concurrent lookups wait for one
+// refresh instead of each requesting a token.
+func (c *RARBG) validToken(ctx context.Context) (string, error) {
 	c.lock.Lock()
-	time.Sleep(2*time.Second - time.Since(c.lastRequest))
-	defer func() {
-		c.lock.Unlock()
-		c.lastRequest = time.Now()
-	}()
+	defer c.lock.Unlock()
+
 	if !c.tokenExpired() {
-		return nil
+		return c.token, nil
+	}
+	err := c.refreshToken(ctx)
+	traceToken(ctx, "RARBG", err)
+	if err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+func (c *RARBG) refreshToken(ctx context.Context) error {
+	url := c.baseURL.String() + "/pubapi_v2.php?app_id=deflix&get_token=get_token"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't create request object: %v", err)
+	}
+
+	if c.tokens != nil {
+		token, created, found, err := c.tokens.GetToken("RARBG")
+		if err != nil {
+			c.logger.Error("couldn't get shared token", zap.Error(err))
+		} else if found && c.clock.Now().Sub(created) <= rarbgTokenAge {
+			c.setToken(token, created)
+			return nil
+		}
+	}
+
+	if err = c.pacer.wait(ctx); err != nil {
+		return err
 	}
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("couldn't GET %v: %v", url, err)
+		return requestError("GET", url, err)
 	}
 	defer func() {
 		_ = res.Body.Close()
@@ -192,18 +251,43 @@ func (c *rarbg) RefreshToken() error {
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("bad GET response: %v", res.StatusCode)
 	}
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("couldn't read response body: %v", err)
+	var v struct {
+		Token string `json:"token"`
+	}
+	if err = decodeJSON(res.Body, &v); err != nil {
+		return fmt.Errorf("couldn't decode token: %v", err)
 	}
-	token := gjson.GetBytes(resBody, "token").String()
+	token := v.Token
 	if token == "" {
 		return fmt.Errorf("token is empty")
 	}
+	c.setToken(token, c.clock.Now())
+
+	if c.tokens != nil {
+		if err = c.tokens.SetToken("RARBG", token, rarbgTokenAge); err != nil {
+			c.logger.Error("couldn't share token", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (c *RARBG) setToken(token string, createdAt time.Time) {
 	c.token = token
-	createdAt := time.Now()
 	c.tokenExpired = func() bool {
-		return time.Since(createdAt).Minutes() > 14
+		return c.clock.Now().Sub(createdAt) > rarbgTokenAge
 	}
-	return nil
+}
+
+func (c *RARBG) Capabilities() Capabilities {
+	return Capabilities{
+		IMDbSearch:  true,
+		Movies:      true,
+		Episodes:    true,
+		SeasonPacks: true,
+		RateLimit:   2 * time.Second,
+	}
+}
+
+func (c *RARBG) Name() string {
+	return "RARBG"
 }
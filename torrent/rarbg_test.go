@@ -0,0 +1,110 @@
+package torrent_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+// TestRARBGPacing checks that token refreshes and lookups of concurrent
+// callers reach the API at least 2s apart.
+func TestRARBGPacing(t *testing.T) {
+	const lookups = 5
+	clock := torrenttest.NewFakeClock(time.Now())
+
+	var (
+		requests []time.Time
+		lock     sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, clock.Now())
+		lock.Unlock()
+		if r.URL.Query().Get("get_token") != "" {
+			fmt.Fprint(w, `{"token":"token"}`)
+			return
+		}
+		fmt.Fprint(w, `{"torrent_results":[]}`)
+	}))
+	defer server.Close()
+
+	opts := torrent.DefaultRARBOpts
+	opts.BaseURL = server.URL
+	opts.Clock = clock
+	client := torrent.NewRARBG(opts, torrent.NewInMemCache(), zap.NewNop())
+
+	errs := make(chan error, lookups)
+	for i := 0; i < lookups; i++ {
+		imdbID := fmt.Sprintf("tt%07d", i+1)
+		go func() {
+			_, err := client.FindMovie(context.Background(), imdbID)
+			errs <- err
+		}()
+	}
+
+	// Only advance the clock while every outstanding request waits on it,
+	// so the server sees the time of each request's slot.
+	total := lookups + 1
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		lock.Lock()
+		handled := len(requests)
+		lock.Unlock()
+		if handled == total {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v requests, want %v", handled, total)
+		}
+		if clock.Waiters() == total-handled {
+			clock.Advance(500 * time.Millisecond)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < lookups; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("couldn't find torrents: %v", err)
+		}
+	}
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].Sub(requests[i-1]); gap < 2*time.Second {
+			t.Errorf("requests %v and %v are %v apart, want at least 2s", i-1, i, gap)
+		}
+	}
+}
+
+func TestRARBGConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("get_token") != "":
+			fmt.Fprint(w, `{"token":"token"}`)
+		case query.Get("search_imdb") == movieID:
+			fmt.Fprint(w, `{"torrent_results":[
+				{"title":"Big.Buck.Bunny.2008.1080p.BluRay.x264","download":"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=bbb","seeders":10,"size":1000},
+				{"title":"Big.Buck.Bunny.2008.DVDRip","download":"magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567&dn=bbb"}]}`)
+		case query.Get("search_imdb") == seriesID && query.Get("search_string") == "S01E01":
+			fmt.Fprint(w, `{"torrent_results":[
+				{"title":"Pioneer.One.S01E01.720p.HDTV.x264","download":"magnet:?xt=urn:btih:2123456789abcdef0123456789abcdef01234567&dn=p1","seeders":5}]}`)
+		default:
+			fmt.Fprint(w, `{"error":"No results found","error_code":20}`)
+		}
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultRARBOpts
+		opts.BaseURL = server.URL
+		opts.Clock = instantClock{}
+		return torrent.NewRARBG(opts, cache, zap.NewNop())
+	})
+}
@@ -0,0 +1,104 @@
+package torrent
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const maxRedirects = 5
+
+// checkRedirect only follows redirects that stay on the registrable domain
+// of the original request, e.g. from yts.mx to www.yts.mx or from
+// mirror1.example.org to mirror2.example.org, and never from https to http.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %v redirects", maxRedirects)
+	}
+	from, to := via[0].URL.Hostname(), req.URL.Hostname()
+	if !sameRegistrableDomain(from, to) {
+		return fmt.Errorf("refusing redirect from %v to %v", from, to)
+	}
+	if downgrade(via[len(via)-1].URL.Scheme, req.URL.Scheme) {
+		return fmt.Errorf("refusing redirect from https to %v", req.URL.Scheme)
+	}
+	return nil
+}
+
+func downgrade(from, to string) bool {
+	return strings.EqualFold(from, "https") && !strings.EqualFold(to, "https")
+}
+
+func sameRegistrableDomain(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	da, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(a))
+	if err != nil {
+		return false
+	}
+	db, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(b))
+	if err != nil {
+		return false
+	}
+	return da == db
+}
+
+// mirror is a provider base URL which follows permanent mirror hops.
+type mirror struct {
+	url  string
+	lock *sync.RWMutex
+}
+
+func newMirror(baseURL string) *mirror {
+	return &mirror{url: baseURL, lock: &sync.RWMutex{}}
+}
+
+func (m *mirror) String() string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.url
+}
+
+// follow moves the base URL to the scheme and host a successful response
+// was finally served from, and reports whether it changed. Only permanent
+// redirects (301 and 308) move it; temporary ones are followed for the
+// request alone.
+func (m *mirror) follow(res *http.Response) (string, bool) {
+	if res.StatusCode != http.StatusOK || res.Request == nil || res.Request.URL == nil || !permanent(res.Request) {
+		return "", false
+	}
+	final := res.Request.URL
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	base, err := url.Parse(m.url)
+	if err != nil || (base.Scheme == final.Scheme && base.Host == final.Host) || downgrade(base.Scheme, final.Scheme) {
+		return "", false
+	}
+	base.Scheme, base.Host = final.Scheme, final.Host
+	m.url = base.String()
+
+	return m.url, true
+}
+
+// permanent reports whether req was reached through redirects, all of them
+// permanent.
+func permanent(req *http.Request) bool {
+	if req.Response == nil {
+		return false
+	}
+	for ; req.Response != nil; req = req.Response.Request {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		default:
+			return false
+		}
+	}
+	return true
+}
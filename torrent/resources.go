@@ -0,0 +1,81 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ResourceOptions bound what a lookup of Torrent may use at once.
+type ResourceOptions struct {
+	// Parallelism is the number of providers queried at the same time, 0
+	// for all. A provider's timeout starts when it's queried, and it holds
+	// its slot until it returns, even after timing out.
+	Parallelism int
+	// MaxResults is the number of results collected per lookup before the
+	// pipeline runs, 0 for no limit. Results beyond are dropped.
+	MaxResults int
+	// MaxBodySize is the number of decoded bytes read from a provider
+	// response, 0 for no limit. Larger responses fail the provider.
+	MaxBodySize int64
+}
+
+// DefaultResourceOpts puts no bounds on lookups.
+var DefaultResourceOpts = ResourceOptions{}
+
+// LowResourceOpts suits Raspberry Pi class devices: providers are queried
+// one after another and responses and results are kept small. Use a
+// Torrent timeout that allows for the serialized queries.
+var LowResourceOpts = ResourceOptions{
+	Parallelism: 1,
+	MaxResults:  200,
+	MaxBodySize: 4 << 20,
+}
+
+// SetResources bounds the resources of every find call. Lookups in
+// progress keep their bounds.
+func (t *Torrent) SetResources(opts ResourceOptions) {
+	t.resourcesLock.Lock()
+	defer t.resourcesLock.Unlock()
+	t.resources = opts
+}
+
+type bodyLimitKey struct{}
+
+func withBodyLimit(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, bodyLimitKey{}, limit)
+}
+
+// limitBody makes reading more than the body limit of the request's
+// context fail instead of buffering it.
+func limitBody(req *http.Request, res *http.Response) *http.Response {
+	limit, _ := req.Context().Value(bodyLimitKey{}).(int64)
+	if limit > 0 {
+		res.Body = &limitedBody{ReadCloser: res.Body, remaining: limit, limit: limit}
+	}
+	return res
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Tell a body of exactly limit bytes from a larger one.
+		var one [1]byte
+		if n, _ := b.ReadCloser.Read(one[:]); n == 0 {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("response body exceeds %v bytes", b.limit)
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
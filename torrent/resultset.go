@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Reasons why a provider didn't contribute to a ResultSet.
+const (
+	ReasonError   = "error"
+	ReasonTimeout = "timeout"
+	ReasonPanic   = "panic"
+	ReasonSkipped = "skipped"
+)
+
+// Degraded names a provider that didn't contribute to a result set.
+type Degraded struct {
+	Provider string `json:"provider"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error,omitempty"`
+	// RetryAfter is when a skipped provider is tried again.
+	RetryAfter *time.Time `json:"retryAfter,omitempty"`
+	// Err is the failure itself, for errors.Is and errors.As.
+	Err error `json:"-"`
+}
+
+func degrade(provider, reason string, err error) Degraded {
+	return Degraded{Provider: provider, Reason: reason, Error: err.Error(), Err: err}
+}
+
+// ResultSet is the outcome of a lookup, including which providers failed,
+// so clients can show partial results and retry later.
+type ResultSet struct {
+	Results  []Result   `json:"results"`
+	Degraded []Degraded `json:"degraded,omitempty"`
+}
+
+// Partial reports whether some providers didn't contribute.
+func (s ResultSet) Partial() bool {
+	return len(s.Degraded) > 0
+}
+
+// Err returns the failures of the degraded providers as *MultiError, nil
+// if all providers contributed. Results can still be complete enough for
+// the caller, so lookups with some results don't fail with it.
+func (s ResultSet) Err() error {
+	if len(s.Degraded) == 0 {
+		return nil
+	}
+	multi := &MultiError{}
+	for _, d := range s.Degraded {
+		err := d.Err
+		if err == nil {
+			err = errors.New(d.Error)
+		}
+		multi.Errors = append(multi.Errors, &ProviderError{Provider: d.Provider, Reason: d.Reason, Err: err})
+	}
+	return multi
+}
+
+// ResultSetFinder is implemented by finders reporting degraded providers,
+// like Torrent.
+type ResultSetFinder interface {
+	FindMovieSet(ctx context.Context, imdbID string) (ResultSet, error)
+	FindEpisodeSet(ctx context.Context, imdbID string, season, episode int) (ResultSet, error)
+}
+
+var _ ResultSetFinder = (*Torrent)(nil)
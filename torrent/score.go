@@ -0,0 +1,127 @@
+package torrent
+
+import (
+	"sort"
+	"strings"
+)
+
+var resolutionScores = map[string]int{
+	"720p":  1,
+	"1080p": 2,
+	"2160p": 3,
+}
+
+// Score ranks a result by resolution first and seeders second. Cam and
+// telesync releases rank below everything else.
+func Score(r Result) int {
+	seeders := r.Seeders
+	if seeders > 999 {
+		seeders = 999
+	}
+	return qualityScore(r) + seeders
+}
+
+// qualityScore is the part of Score that doesn't depend on seeders.
+func qualityScore(r Result) int {
+	score := resolutionScore(r) * 1000
+	if strings.Contains(r.Quality, "cam") || strings.Contains(r.Quality, "telesync") {
+		score -= 10000
+	}
+	return score
+}
+
+// IsUpgrade reports whether r ranks above the release named have by
+// quality, in the order of Score. An empty have is upgraded by anything
+// that isn't a cam or telesync.
+func IsUpgrade(have string, r Result) bool {
+	return qualityScore(r) > qualityScore(Result{Name: have, Quality: qualityFromName(have)})
+}
+
+func resolutionScore(r Result) int {
+	if fields := strings.Fields(r.Quality); len(fields) > 0 {
+		return resolutionScores[fields[0]]
+	}
+	return 0
+}
+
+// Best returns the highest scored result.
+func Best(results []Result) (Result, bool) {
+	if len(results) == 0 {
+		return Result{}, false
+	}
+	best := results[0]
+	for _, r := range results[1:] {
+		if Score(r) > Score(best) {
+			best = r
+		}
+	}
+	return best, true
+}
+
+// SortByScore orders results from best to worst.
+func SortByScore(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return Score(results[i]) > Score(results[j])
+	})
+}
+
+// BestWithin returns the highest scored result not larger than budget bytes.
+func BestWithin(results []Result, budget int) (Result, bool) {
+	var fitting []Result
+	for _, r := range results {
+		if r.Size <= budget {
+			fitting = append(fitting, r)
+		}
+	}
+	return Best(fitting)
+}
+
+// selectWithin greedily picks one result per group whose summed size stays
+// within budget. It starts from the smallest result of every group and
+// applies the upgrade with the best score gain per byte until none fits, so
+// the summed score isn't necessarily the highest possible. ok is false if
+// even the smallest results don't fit, in which case those are returned.
+// Groups must not be empty.
+func selectWithin(groups [][]Result, budget int) (selected []Result, ok bool) {
+	choice := make([]int, len(groups))
+	sorted := make([][]Result, len(groups))
+	total := 0
+	for i, group := range groups {
+		sorted[i] = append([]Result(nil), group...)
+		sort.SliceStable(sorted[i], func(a, b int) bool {
+			return sorted[i][a].Size < sorted[i][b].Size
+		})
+		total += sorted[i][0].Size
+	}
+
+	ok = total <= budget
+	for ok {
+		bestGain, bestGroup, bestChoice := 0.0, -1, -1
+		for i, group := range sorted {
+			current := group[choice[i]]
+			for j, candidate := range group {
+				scoreGain := Score(candidate) - Score(current)
+				extra := candidate.Size - current.Size
+				if scoreGain <= 0 || total+extra > budget {
+					continue
+				}
+				if extra < 1 {
+					extra = 1
+				}
+				if gain := float64(scoreGain) / float64(extra); gain > bestGain {
+					bestGain, bestGroup, bestChoice = gain, i, j
+				}
+			}
+		}
+		if bestGroup < 0 {
+			break
+		}
+		total += sorted[bestGroup][bestChoice].Size - sorted[bestGroup][choice[bestGroup]].Size
+		choice[bestGroup] = bestChoice
+	}
+
+	for i, group := range sorted {
+		selected = append(selected, group[choice[i]])
+	}
+	return selected, ok
+}
@@ -2,18 +2,25 @@ package torrent
 
 import (
 	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"html"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/parse"
 	"go.uber.org/zap"
 )
 
-var magnet2InfoHashRegex = regexp.MustCompile(`btih:.+?&`)
+var magnet2InfoHashRegex = regexp.MustCompile(`(?i)urn:btih:([0-9a-z]+)`)
 
 type findFunc func(context.Context, MagnetFinder) ([]Result, error)
 
@@ -27,105 +34,284 @@ type MagnetFinder interface {
 	FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error)
 }
 
+// Named is implemented by finders with a provider name.
+type Named interface {
+	Name() string
+}
+
+// ProviderName returns the name of finder, falling back to its type.
+func ProviderName(finder MagnetFinder) string {
+	if n, ok := finder.(Named); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", finder)
+}
+
+// Provider is implemented by all built-in providers, so they can be
+// wrapped, decorated or mocked as one interface.
+type Provider interface {
+	MagnetFinder
+	Named
+	CapabilityProvider
+}
+
+// SeasonFinder is implemented by finders that can search for season packs.
+type SeasonFinder interface {
+	FindSeason(ctx context.Context, imdbID string, season int) ([]Result, error)
+}
+
 type Torrent struct {
-	logger  *zap.Logger
-	timeout time.Duration
-	clients []MagnetFinder
+	logger   *zap.Logger
+	timeout  time.Duration
+	clients  []MagnetFinder
+	pipeline Pipeline
+	failures *FailureCache
+	limit    int
+	events   *eventBus
+
+	resources     ResourceOptions
+	resourcesLock *sync.Mutex
 }
 
 func NewTorrent(clients []MagnetFinder, timeout time.Duration, logger *zap.Logger) *Torrent {
 	return &Torrent{
-		clients: clients,
-		timeout: timeout,
-		logger:  logger,
+		clients:       clients,
+		timeout:       timeout,
+		logger:        logger,
+		pipeline:      DefaultPipeline,
+		failures:      NewFailureCache(DefaultFailureCacheOpts),
+		events:        newEventBus(),
+		resourcesLock: &sync.Mutex{},
 	}
 }
 
+// Failures returns the cache of failing provider lookups, which are skipped
+// until their TTL expires. It is nil if disabled.
+func (t *Torrent) Failures() *FailureCache {
+	return t.failures
+}
+
+// SetFailureCache replaces the failure cache, nil disables it.
+func (t *Torrent) SetFailureCache(failures *FailureCache) {
+	t.failures = failures
+}
+
+// SetPipeline replaces the post-processing applied to combined results.
+func (t *Torrent) SetPipeline(pipeline Pipeline) {
+	t.pipeline = pipeline
+}
+
+// SetLimit caps the number of results of every find call after the
+// pipeline ran, 0 for no limit. Pages requested with WithPage are cut from
+// the capped results.
+func (t *Torrent) SetLimit(limit int) {
+	t.limit = limit
+}
+
+// FindMovie returns the results of all providers. If some of them failed,
+// the results of the others are returned with the *MultiError of
+// ResultSet.Err.
 func (t *Torrent) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	set, err := t.FindMovieSet(ctx, imdbID)
+	if err != nil {
+		return set.Results, err
+	}
+	return set.Results, set.Err()
+}
+
+// FindMovieSet is FindMovie, reporting providers that failed or timed out.
+func (t *Torrent) FindMovieSet(ctx context.Context, imdbID string) (ResultSet, error) {
 	find := func(ctx context.Context, siteClient MagnetFinder) ([]Result, error) {
 		return siteClient.FindMovie(ctx, imdbID)
 	}
-	return t.find(ctx, find)
+	return t.find(ctx, imdbID, t.route(func(c Capabilities) bool { return c.Movies }), find)
 }
 
+// FindEpisode is FindMovie for an episode.
 func (t *Torrent) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+	set, err := t.FindEpisodeSet(ctx, imdbID, season, episode)
+	if err != nil {
+		return set.Results, err
+	}
+	return set.Results, set.Err()
+}
+
+// FindEpisodeSet is FindEpisode, reporting providers that failed or timed
+// out.
+func (t *Torrent) FindEpisodeSet(ctx context.Context, imdbID string, season, episode int) (ResultSet, error) {
 	find := func(ctx context.Context, siteClient MagnetFinder) ([]Result, error) {
 		return siteClient.FindEpisode(ctx, imdbID, season, episode)
 	}
-	return t.find(ctx, find)
+	key := fmt.Sprintf("%v:%v:%v", imdbID, season, episode)
+	return t.find(ctx, key, t.route(func(c Capabilities) bool { return c.Episodes }), find)
 }
 
-func (t *Torrent) find(ctx context.Context, find findFunc) ([]Result, error) {
-	clients := len(t.clients)
-	errChan := make(chan error, clients)
-	resChan := make(chan []Result, clients)
+// FindSeason searches season packs on all finders implementing SeasonFinder.
+// Like FindMovie, it returns partial results with the failures.
+func (t *Torrent) FindSeason(ctx context.Context, imdbID string, season int) ([]Result, error) {
+	find := func(ctx context.Context, siteClient MagnetFinder) ([]Result, error) {
+		return siteClient.(SeasonFinder).FindSeason(ctx, imdbID, season)
+	}
+	var finders []MagnetFinder
+	for _, client := range t.route(func(c Capabilities) bool { return c.SeasonPacks }) {
+		if _, ok := client.(SeasonFinder); ok {
+			finders = append(finders, client)
+		}
+	}
+	set, err := t.find(ctx, fmt.Sprintf("%v:%v", imdbID, season), finders, find)
+	if err != nil {
+		return set.Results, err
+	}
+	return set.Results, set.Err()
+}
 
+// route returns the clients whose capabilities are accepted by supports.
+func (t *Torrent) route(supports func(Capabilities) bool) []MagnetFinder {
+	var routed []MagnetFinder
 	for _, client := range t.clients {
-		timer := time.NewTimer(t.timeout)
-		go func(finder MagnetFinder, timer *time.Timer) {
+		if supports(CapabilitiesOf(client)) {
+			routed = append(routed, client)
+		}
+	}
+	return routed
+}
+
+func (t *Torrent) find(ctx context.Context, key string, finders []MagnetFinder, find findFunc) (ResultSet, error) {
+	ctx = withBus(ensureRequestID(ctx), t.events)
+	clients := len(finders)
+	if clients == 0 {
+		return ResultSet{}, nil
+	}
+	traceQuery(ctx, key, clients)
+	errChan := make(chan Degraded, clients)
+	resChan := make(chan []Result, clients)
+	t.resourcesLock.Lock()
+	resources := t.resources
+	t.resourcesLock.Unlock()
+	if resources.MaxBodySize > 0 {
+		ctx = withBodyLimit(ctx, resources.MaxBodySize)
+	}
+	var slots chan struct{}
+	if resources.Parallelism > 0 {
+		slots = make(chan struct{}, resources.Parallelism)
+	}
+
+	for _, client := range finders {
+		go func(finder MagnetFinder) {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					errChan <- degrade(ProviderName(finder), ReasonTimeout, ctx.Err())
+					return
+				}
+			}
+			timer := time.NewTimer(t.timeout)
 			defer timer.Stop()
 
-			siteResChan := make(chan []Result)
-			siteErrChan := make(chan error)
+			// Buffered, so the lookup can finish after a timeout
+			// without blocking forever.
+			siteResChan := make(chan []Result, 1)
+			siteErrChan := make(chan Degraded, 1)
 			go func() {
+				// The slot is held until the provider returns, also after
+				// a timeout, so slow providers can't pile up beyond
+				// Parallelism.
+				if slots != nil {
+					defer func() { <-slots }()
+				}
+				provider := ProviderName(finder)
+				// A bug in one provider mustn't take down the whole lookup.
+				defer func() {
+					if r := recover(); r != nil {
+						err := fmt.Errorf("panic: %v", r)
+						ContextLogger(ctx, t.logger).Error("provider panicked", zap.String("provider", provider),
+							zap.Any("panic", r), zap.Stack("stack"))
+						if t.failures != nil {
+							t.failures.Fail(provider, key, err)
+						}
+						traceProvider(ctx, provider, 0, 0, err)
+						siteErrChan <- degrade(provider, ReasonPanic, err)
+					}
+				}()
+				if t.failures != nil {
+					if failure, blocked := t.failures.Blocked(provider, key); blocked {
+						err := fmt.Errorf("skipped after %v failures: %v", failure.Count, failure.LastError)
+						traceProvider(ctx, provider, 0, 0, err)
+						d := degrade(provider, ReasonSkipped, err)
+						until := failure.Until
+						d.RetryAfter = &until
+						siteErrChan <- d
+						return
+					}
+				}
+				start := time.Now()
 				results, err := find(ctx, finder)
+				traceProvider(ctx, provider, len(results), time.Since(start), err)
 				if err != nil {
-					siteErrChan <- err
+					// A canceled lookup says nothing about the provider.
+					if t.failures != nil && ctx.Err() == nil && !errors.Is(err, context.Canceled) {
+						t.failures.Fail(provider, key, err)
+					}
+					siteErrChan <- degrade(provider, ReasonError, err)
 				} else {
+					if t.failures != nil {
+						t.failures.Succeed(provider, key)
+					}
 					siteResChan <- results
 				}
 			}()
 			select {
 			case res := <-siteResChan:
 				resChan <- res
-			case err := <-siteErrChan:
-				errChan <- err
+			case degraded := <-siteErrChan:
+				errChan <- degraded
 			case <-timer.C:
-				resChan <- nil
+				provider := ProviderName(finder)
+				traceProvider(ctx, provider, 0, t.timeout, ErrTimeout)
+				errChan <- degrade(provider, ReasonTimeout, ErrTimeout)
 			}
-		}(client, timer)
+		}(client)
 	}
 
 	var combinedResults []Result
-	var errs []error
-	dupRemovalRequired := false
+	var degraded []Degraded
+	failed := 0
 	for i := 0; i < clients; i++ {
 		select {
 		case results := <-resChan:
-			if !dupRemovalRequired && len(combinedResults) > 0 && len(results) > 0 {
-				dupRemovalRequired = true
+			if maxResults := resources.MaxResults; maxResults > 0 && len(combinedResults)+len(results) > maxResults {
+				results = results[:maxResults-len(combinedResults)]
 			}
 			combinedResults = append(combinedResults, results...)
-		case err := <-errChan:
-			errs = append(errs, err)
+		case d := <-errChan:
+			degraded = append(degraded, d)
+			// Timeouts don't count as errors, a slow site isn't a broken one.
+			if d.Reason != ReasonTimeout {
+				failed++
+			}
 		}
 	}
+	sort.Slice(degraded, func(i, j int) bool {
+		return degraded[i].Provider < degraded[j].Provider
+	})
 
-	returnErrors := len(errs) == clients
-
-	if returnErrors {
-		errsMsg := "couldn't find torrents on any site: "
-		for i := 1; i <= clients; i++ {
-			errsMsg += fmt.Sprintf("%v.: %v; ", i, errs[i-1])
-		}
-		errsMsg = strings.TrimSuffix(errsMsg, "; ")
-		return nil, fmt.Errorf(errsMsg)
+	if failed == clients {
+		set := ResultSet{Degraded: degraded}
+		return set, fmt.Errorf("couldn't find torrents on any site: %w", set.Err())
 	}
 
-	var noDupResults []Result
-	if dupRemovalRequired {
-		infoHashes := map[string]struct{}{}
-		for _, result := range combinedResults {
-			if _, ok := infoHashes[result.InfoHash]; !ok {
-				noDupResults = append(noDupResults, result)
-				infoHashes[result.InfoHash] = struct{}{}
-			}
-		}
-	} else {
-		noDupResults = combinedResults
+	results, err := t.pipeline.Run(ctx, combinedResults)
+	if err != nil {
+		return ResultSet{Degraded: degraded}, err
+	}
+	TagEditions(results)
+	results = Page{Limit: t.limit}.Apply(results)
+	if page, ok := PageFrom(ctx); ok {
+		results = page.Apply(results)
 	}
 
-	return noDupResults, nil
+	return ResultSet{Results: results, Degraded: degraded}, nil
 }
 
 type Result struct {
@@ -134,20 +320,85 @@ type Result struct {
 	Quality   string
 	InfoHash  string
 	MagnetURL string
+	Provider  string
 
 	Seeders int
 	Fuzzy   bool
 	Size    int
+	// Edition is the edition parsed from Name, like "Director's Cut". It
+	// is set on results of Torrent, see TagEditions.
+	Edition string
 }
 
 func createMagnetURL(_ context.Context, infoHash, title string, trackers []string) string {
 	magnetURL := "magnet:?xt=urn:btih:" + infoHash + "&dn=" + url.QueryEscape(title)
 	for _, tracker := range trackers {
-		magnetURL += "&tr" + tracker
+		magnetURL += "&tr=" + url.QueryEscape(tracker)
 	}
 	return magnetURL
 }
 
+// infoHashFromMagnet returns the info hash of a magnet link normalized by
+// normalizeInfoHash, or "" if it has no valid one.
+func infoHashFromMagnet(magnet string) string {
+	match := magnet2InfoHashRegex.FindStringSubmatch(magnet)
+	if match == nil {
+		return ""
+	}
+	return normalizeInfoHash(match[1])
+}
+
+// normalizeInfoHash returns hash as 40 lower case hex characters, converting
+// base32 encoded hashes. Anything else yields "", so results never carry
+// malformed hashes from untrusted tracker responses.
+func normalizeInfoHash(hash string) string {
+	switch len(hash) {
+	case 40:
+		if _, err := hex.DecodeString(hash); err != nil {
+			return ""
+		}
+		return strings.ToLower(hash)
+	case 32:
+		b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+		if err != nil {
+			return ""
+		}
+		return hex.EncodeToString(b)
+	}
+	return ""
+}
+
+// cleanName decodes HTML entities, which scraped names often contain, and
+// drops invalid UTF-8, which would break matching and JSON encoding.
+func cleanName(name string) string {
+	if strings.Contains(name, "&") {
+		name = html.UnescapeString(name)
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(name, ""))
+}
+
+func qualityFromName(name string) string {
+	quality := ""
+	if strings.Contains(name, "720p") {
+		quality = "720p"
+	} else if strings.Contains(name, "1080p") {
+		quality = "1080p"
+	} else if strings.Contains(name, "2160p") {
+		quality = "2160p"
+	} else {
+		return ""
+	}
+	if strings.Contains(name, "10bit") {
+		quality += " 10bit"
+	}
+	if strings.Contains(name, "HDCAM") {
+		quality += " (⚠️cam)"
+	} else if strings.Contains(name, "HDTS") || strings.Contains(name, "HD-TS") {
+		quality += " (⚠️telesync)"
+	}
+	return quality
+}
+
 func createSeriesSearch(ctx context.Context, metaGetter MetaGetter, imdbID string, season, episode int) (string, error) {
 	id := imdbID + ":" + strconv.Itoa(season) + ":" + strconv.Itoa(episode)
 	m, err := metaGetter.GetEpisode(ctx, imdbID)
@@ -162,5 +413,5 @@ func createSeriesSearch(ctx context.Context, metaGetter MetaGetter, imdbID strin
 	if episode < 10 {
 		episodeString = "0" + episodeString
 	}
-	return fmt.Sprintf("%v S%vE%v", m.Title, seasonString, episodeString), nil
+	return fmt.Sprintf("%v S%vE%v", parse.SanitizeTitle(m.Title), seasonString, episodeString), nil
 }
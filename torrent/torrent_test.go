@@ -0,0 +1,35 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func FuzzInfoHashFromMagnet(f *testing.F) {
+	for _, seed := range []string{
+		"magnet:?xt=urn:btih:0123456789ABCDEF0123456789abcdef01234567&dn=x",
+		"magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVSYTK7TUKZCGVQG",
+		"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef0123456z",
+		"magnet:?xt=urn:btih:",
+		"urn:btih:" + strings.Repeat("a", 41),
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, magnet string) {
+		hash := infoHashFromMagnet(magnet)
+		if hash == "" {
+			return
+		}
+		if len(hash) != 40 || strings.ToLower(hash) != hash {
+			t.Fatalf("hash of %q isn't 40 lower case characters: %q", magnet, hash)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			t.Fatalf("hash of %q isn't hex: %q", magnet, hash)
+		}
+		if normalizeInfoHash(hash) != hash {
+			t.Fatalf("hash of %q isn't normalized: %q", magnet, hash)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package torrenttest
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jelliflix/imdb/parse"
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+// BenchFactory creates the finder under benchmark with the given cache.
+type BenchFactory func(b *testing.B, cache torrent.Cache) torrent.MagnetFinder
+
+// Budget is the performance a benchmark must stay within. Budgets are
+// checked in review against the output of go test -bench -benchmem, or in
+// code with Check and testing.Benchmark. 0 means no limit.
+type Budget struct {
+	Name        string
+	NsPerOp     int64
+	AllocsPerOp int64
+}
+
+// Budgets are the budgets of the benchmarks in this package with a few
+// times the measured cost as margin. FanOut is for 5 providers with 50
+// results each, Decode for a response with 50 results. Raise one only with
+// a reason in the review.
+var Budgets = []Budget{
+	{Name: "CacheHit", NsPerOp: 20_000, AllocsPerOp: 50},
+	{Name: "FanOut", NsPerOp: 1_000_000, AllocsPerOp: 2_000},
+	{Name: "Parse", NsPerOp: 20_000, AllocsPerOp: 40},
+	{Name: "Decode", NsPerOp: 5_000_000, AllocsPerOp: 20_000},
+}
+
+// Check returns an error if r exceeds the budget.
+func (bu Budget) Check(r testing.BenchmarkResult) error {
+	if bu.NsPerOp > 0 && r.NsPerOp() > bu.NsPerOp {
+		return fmt.Errorf("%v: %v ns/op exceeds budget of %v ns/op", bu.Name, r.NsPerOp(), bu.NsPerOp)
+	}
+	if bu.AllocsPerOp > 0 && r.AllocsPerOp() > bu.AllocsPerOp {
+		return fmt.Errorf("%v: %v allocs/op exceeds budget of %v allocs/op", bu.Name, r.AllocsPerOp(), bu.AllocsPerOp)
+	}
+	return nil
+}
+
+// BenchmarkCacheHit measures lookups served from the cache, the hot path of
+// a server.
+func BenchmarkCacheHit(b *testing.B, imdbID string, newFinder BenchFactory) {
+	finder := newFinder(b, torrent.NewInMemCache())
+	ctx := context.Background()
+	if _, err := finder.FindMovie(ctx, imdbID); err != nil {
+		b.Fatalf("FindMovie(%q) failed: %v", imdbID, err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := finder.FindMovie(ctx, imdbID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFanOut measures the overhead of Torrent, including its default
+// pipeline, when querying the given number of providers, each of which
+// immediately returns the given number of results.
+func BenchmarkFanOut(b *testing.B, providers, results int) {
+	var finders []torrent.MagnetFinder
+	for i := 0; i < providers; i++ {
+		finders = append(finders, &staticFinder{name: "bench" + strconv.Itoa(i), results: fakeResults(i, results)})
+	}
+	client := torrent.NewTorrent(finders, time.Minute, zap.NewNop())
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.FindMovie(ctx, "tt0000001"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParse measures the release name parser, one name per op, and
+// reports its throughput as releases/s.
+func BenchmarkParse(b *testing.B, names []string) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		parse.ParseRelease(names[i%len(names)])
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "releases/s")
+}
+
+// BenchmarkDecode measures lookups that miss the cache, so the upstream
+// response is decoded every time. Point the finder at a fake upstream
+// serving a recorded response.
+func BenchmarkDecode(b *testing.B, imdbID string, newFinder BenchFactory) {
+	finder := newFinder(b, missCache{})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := finder.FindMovie(ctx, imdbID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type staticFinder struct {
+	name    string
+	results []torrent.Result
+}
+
+func (f *staticFinder) FindMovie(context.Context, string) ([]torrent.Result, error) {
+	return f.results, nil
+}
+
+func (f *staticFinder) FindEpisode(context.Context, string, int, int) ([]torrent.Result, error) {
+	return f.results, nil
+}
+
+func (f *staticFinder) Name() string {
+	return f.name
+}
+
+func fakeResults(provider, n int) []torrent.Result {
+	results := make([]torrent.Result, n)
+	for i := range results {
+		hash := make([]byte, 20)
+		hash[0], hash[1] = byte(provider), byte(i)
+		infoHash := hex.EncodeToString(hash)
+		results[i] = torrent.Result{
+			Name:      fmt.Sprintf("Movie.Title.2021.1080p.WEB.x264-GRP%v", i),
+			Title:     "Movie Title",
+			Quality:   "1080p",
+			InfoHash:  infoHash,
+			MagnetURL: "magnet:?xt=urn:btih:" + infoHash,
+			Seeders:   i,
+		}
+	}
+	return results
+}
+
+type missCache struct{}
+
+func (missCache) Set(string, []torrent.Result) error {
+	return nil
+}
+
+func (missCache) Get(string) ([]torrent.Result, time.Time, bool, error) {
+	return nil, time.Time{}, false, nil
+}
@@ -0,0 +1,76 @@
+package torrenttest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+)
+
+var _ torrent.Clock = (*FakeClock)(nil)
+
+// FakeClock is a torrent.Clock that only moves on Advance, so tests can
+// simulate token expiry, cache ages and pacing without sleeping.
+type FakeClock struct {
+	now     time.Time
+	waiters []waiter
+	lock    *sync.Mutex
+}
+
+type waiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewFakeClock returns a clock starting at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start, lock: &sync.Mutex{}}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{until: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the After channels that
+// are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+
+	sort.Slice(c.waiters, func(i, j int) bool {
+		return c.waiters[i].until.Before(c.waiters[j].until)
+	})
+	var pending []waiter
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of pending After channels, so tests can wait
+// for a goroutine to block on the clock before advancing it.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
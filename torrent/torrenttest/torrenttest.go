@@ -0,0 +1,185 @@
+// Package torrenttest provides a conformance suite for MagnetFinder
+// implementations, so third-party providers can verify they behave like the
+// built-in ones.
+package torrenttest
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+)
+
+// Factory creates the finder under test with the given cache. It is called
+// once per test, so tests don't share cached results.
+type Factory func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder
+
+// Cases are the lookups the suite runs. They usually point to a fake
+// upstream server rather than a live site.
+type Cases struct {
+	// Movie is an IMDb ID with results.
+	Movie string
+	// Episode is an episode with results. It is only used if the finder
+	// supports episodes.
+	Episode Episode
+	// Missing is an IMDb ID without any results.
+	Missing string
+	// CancelTimeout is how long a finder may take to return once its
+	// context is canceled, 5s if 0.
+	CancelTimeout time.Duration
+}
+
+type Episode struct {
+	IMDbID  string
+	Season  int
+	Episode int
+}
+
+// RunFinderTests checks that a finder
+//   - returns well-formed results: a name, a valid info hash and a magnet URL
+//     containing it,
+//   - returns no results and no error for titles it can't find,
+//   - returns no results for episodes if it doesn't support them,
+//   - stores results in the cache and serves repeated lookups from it,
+//   - returns promptly after its context is canceled.
+func RunFinderTests(t *testing.T, cases Cases, newFinder Factory) {
+	t.Helper()
+
+	t.Run("Movie", func(t *testing.T) {
+		finder := newFinder(t, torrent.NewInMemCache())
+		results, err := finder.FindMovie(context.Background(), cases.Movie)
+		if err != nil {
+			t.Fatalf("FindMovie(%q) failed: %v", cases.Movie, err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("FindMovie(%q) returned no results", cases.Movie)
+		}
+		checkResults(t, results)
+	})
+
+	t.Run("Episode", func(t *testing.T) {
+		finder := newFinder(t, torrent.NewInMemCache())
+		e := cases.Episode
+		results, err := finder.FindEpisode(context.Background(), e.IMDbID, e.Season, e.Episode)
+		if !torrent.CapabilitiesOf(finder).Episodes {
+			if len(results) > 0 {
+				t.Errorf("FindEpisode returned %v results without episode support", len(results))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("FindEpisode(%q, %v, %v) failed: %v", e.IMDbID, e.Season, e.Episode, err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("FindEpisode(%q, %v, %v) returned no results", e.IMDbID, e.Season, e.Episode)
+		}
+		checkResults(t, results)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		finder := newFinder(t, torrent.NewInMemCache())
+		results, err := finder.FindMovie(context.Background(), cases.Missing)
+		if err != nil {
+			t.Errorf("FindMovie(%q) failed instead of returning no results: %v", cases.Missing, err)
+		}
+		if len(results) > 0 {
+			t.Errorf("FindMovie(%q) returned %v results, want none", cases.Missing, len(results))
+		}
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		cache := &countingCache{Cache: torrent.NewInMemCache(), lock: &sync.Mutex{}}
+		finder := newFinder(t, cache)
+		first, err := finder.FindMovie(context.Background(), cases.Movie)
+		if err != nil {
+			t.Fatalf("FindMovie(%q) failed: %v", cases.Movie, err)
+		}
+		sets := cache.count()
+		if sets == 0 {
+			t.Fatalf("FindMovie(%q) didn't store its results in the cache", cases.Movie)
+		}
+
+		second, err := finder.FindMovie(context.Background(), cases.Movie)
+		if err != nil {
+			t.Fatalf("cached FindMovie(%q) failed: %v", cases.Movie, err)
+		}
+		if cache.count() != sets {
+			t.Errorf("repeated FindMovie(%q) wasn't served from the cache", cases.Movie)
+		}
+		if len(first) != len(second) {
+			t.Errorf("cached FindMovie(%q) returned %v results, want %v", cases.Movie, len(second), len(first))
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		timeout := cases.CancelTimeout
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+
+		finder := newFinder(t, torrent.NewInMemCache())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		done := make(chan []torrent.Result, 1)
+		go func() {
+			results, _ := finder.FindMovie(ctx, cases.Movie)
+			done <- results
+		}()
+		select {
+		case results := <-done:
+			checkResults(t, results)
+		case <-time.After(timeout):
+			t.Errorf("FindMovie with canceled context didn't return within %v", timeout)
+		}
+	})
+}
+
+func checkResults(t *testing.T, results []torrent.Result) {
+	t.Helper()
+	for _, r := range results {
+		if r.Name == "" {
+			t.Errorf("result %+v has no name", r)
+		}
+		if !validInfoHash(r.InfoHash) {
+			t.Errorf("result %q has invalid info hash %q", r.Name, r.InfoHash)
+		}
+		if !strings.HasPrefix(r.MagnetURL, "magnet:?") ||
+			!strings.Contains(strings.ToLower(r.MagnetURL), strings.ToLower(r.InfoHash)) {
+			t.Errorf("result %q has invalid magnet URL %q", r.Name, r.MagnetURL)
+		}
+	}
+}
+
+// validInfoHash accepts hex encoded SHA-1 hashes. Built-in providers
+// normalize base32 hashes to hex.
+func validInfoHash(hash string) bool {
+	if len(hash) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+type countingCache struct {
+	torrent.Cache
+	sets int
+	lock *sync.Mutex
+}
+
+func (c *countingCache) Set(key string, results []torrent.Result) error {
+	c.lock.Lock()
+	c.sets++
+	c.lock.Unlock()
+	return c.Cache.Set(key, results)
+}
+
+func (c *countingCache) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.sets
+}
@@ -0,0 +1,508 @@
+package torrent
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+	"github.com/jelliflix/imdb/parse"
+	"go.uber.org/zap"
+)
+
+type TorznabOptions struct {
+	// BaseURL is the API endpoint of the indexer, e.g.
+	// http://localhost:9117/api/v2.0/indexers/1337x/results/torznab/api.
+	BaseURL  string
+	APIKey   string
+	Name     string
+	Timeout  time.Duration
+	CacheAge time.Duration
+	CapsAge  time.Duration
+	Hooks    Hooks
+
+	// Clock is the time source of cache and caps ages, SystemClock if nil.
+	Clock Clock
+
+	// Credentials resolves the API key named "torznab" before every
+	// request, overriding APIKey.
+	Credentials credentials.Store
+}
+
+var DefaultTorznabOpts = TorznabOptions{
+	Name:     "Torznab",
+	Timeout:  20 * time.Second,
+	CacheAge: 24 * time.Hour,
+	CapsAge:  24 * time.Hour,
+}
+
+// TorznabSearch is one search function of an indexer and the parameters it
+// supports, like "q", "imdbid", "season" and "ep".
+type TorznabSearch struct {
+	Available bool
+	Params    []string
+}
+
+func (s TorznabSearch) Supports(param string) bool {
+	if !s.Available {
+		return false
+	}
+	for _, p := range s.Params {
+		if strings.EqualFold(p, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// TorznabCaps are the capabilities an indexer advertises with t=caps.
+type TorznabCaps struct {
+	Version     string
+	Search      TorznabSearch
+	TVSearch    TorznabSearch
+	MovieSearch TorznabSearch
+	Categories  []string
+}
+
+// clone copies the caps with their parameter and category lists, so the
+// copy can be read while downgrade changes the original.
+func (c TorznabCaps) clone() TorznabCaps {
+	c.Search.Params = append([]string(nil), c.Search.Params...)
+	c.TVSearch.Params = append([]string(nil), c.TVSearch.Params...)
+	c.MovieSearch.Params = append([]string(nil), c.MovieSearch.Params...)
+	c.Categories = append([]string(nil), c.Categories...)
+	return c
+}
+
+// TorznabError is an error response of an indexer.
+type TorznabError struct {
+	Code        int
+	Description string
+}
+
+func (e *TorznabError) Error() string {
+	return fmt.Sprintf("torznab error %v: %v", e.Code, e.Description)
+}
+
+// Unsupported reports whether the indexer rejected the function or its
+// parameters, as opposed to failing, so a simpler search may succeed.
+func (e *TorznabError) Unsupported() bool {
+	return e.Code >= 200 && e.Code <= 203
+}
+
+var _ Provider = (*Torznab)(nil)
+
+// Torznab searches a single Torznab indexer. Searches are negotiated with the
+// capabilities of the indexer: IMDb ID searches are only sent to indexers
+// advertising them and downgrade to title searches otherwise, or when the
+// indexer rejects them anyway.
+type Torznab struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	creds      credentials.Store
+	httpClient *http.Client
+	cache      Cache
+	cacheAge   time.Duration
+	clock      Clock
+	capsAge    time.Duration
+	metaGetter MetaGetter
+	logger     *zap.Logger
+
+	caps      *TorznabCaps
+	capsFetch time.Time
+	lock      *sync.Mutex
+}
+
+func NewTorznab(opts TorznabOptions, cache Cache, metaGetter MetaGetter, logger *zap.Logger) *Torznab {
+	name := opts.Name
+	if name == "" {
+		name = "Torznab"
+	}
+	return &Torznab{
+		name:       name,
+		baseURL:    opts.BaseURL,
+		apiKey:     opts.APIKey,
+		creds:      opts.Credentials,
+		httpClient: newHTTPClient(name, opts.Timeout, opts.Hooks),
+		cache:      cache,
+		cacheAge:   opts.CacheAge,
+		clock:      clockOr(opts.Clock),
+		capsAge:    opts.CapsAge,
+		metaGetter: metaGetter,
+		logger:     logger,
+		lock:       &sync.Mutex{},
+	}
+}
+
+func (c *Torznab) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	caps, err := c.Caps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := CacheKey{ID: imdbID}
+	if caps.MovieSearch.Supports("imdbid") {
+		params := url.Values{"t": {"movie"}, "imdbid": {strings.TrimPrefix(imdbID, "tt")}, "cat": {jackettMovieCategory}}
+		results, err := c.find(ctx, key, params)
+		if !c.downgrade(ctx, err, imdbID, "movie") {
+			return results, err
+		}
+	}
+
+	m, err := c.metaGetter.GetMovie(ctx, imdbID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get movie title for IMDb ID %v: %v", imdbID, err)
+	}
+	query := parse.SanitizeTitle(m.Title)
+	if m.Year > 0 {
+		query += " " + strconv.Itoa(m.Year)
+	}
+
+	params := url.Values{"q": {query}, "cat": {jackettMovieCategory}}
+	switch {
+	case caps.MovieSearch.Supports("q"):
+		params.Set("t", "movie")
+	case caps.Search.Available:
+		params.Set("t", "search")
+	default:
+		return nil, fmt.Errorf("%v has no movie search: %w", c.name, ErrUnsupported)
+	}
+	return c.find(ctx, key, params)
+}
+
+func (c *Torznab) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+	caps, err := c.Caps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := CacheKey{ID: imdbID, Season: season, Episode: episode}
+	s, ep := strconv.Itoa(season), strconv.Itoa(episode)
+	tv := caps.TVSearch
+	if tv.Supports("imdbid") && tv.Supports("season") && tv.Supports("ep") {
+		params := url.Values{"t": {"tvsearch"}, "imdbid": {strings.TrimPrefix(imdbID, "tt")}, "season": {s}, "ep": {ep}, "cat": {jackettTVCategory}}
+		results, err := c.find(ctx, key, params)
+		if !c.downgrade(ctx, err, imdbID, "tvsearch") {
+			return results, err
+		}
+	}
+
+	var params url.Values
+	switch {
+	case tv.Supports("q") && tv.Supports("season") && tv.Supports("ep"):
+		m, err := c.metaGetter.GetEpisode(ctx, imdbID)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get TV show title for ID %v: %v", imdbID, err)
+		}
+		params = url.Values{"t": {"tvsearch"}, "q": {parse.SanitizeTitle(m.Title)}, "season": {s}, "ep": {ep}}
+	case tv.Supports("q") || caps.Search.Available:
+		query, err := createSeriesSearch(ctx, c.metaGetter, imdbID, season, episode)
+		if err != nil {
+			return nil, err
+		}
+		params = url.Values{"t": {"search"}, "q": {query}}
+		if tv.Supports("q") {
+			params.Set("t", "tvsearch")
+		}
+	default:
+		return nil, fmt.Errorf("%v has no TV search: %w", c.name, ErrUnsupported)
+	}
+	params.Set("cat", jackettTVCategory)
+
+	results, err := c.find(ctx, key, params)
+	if err != nil {
+		return nil, err
+	}
+	return filterEpisode(results, season, episode, "", false), nil
+}
+
+// downgrade reports whether an IMDb ID search failed because the indexer
+// doesn't support it after all, so a title search should be tried. The
+// function is then treated as not supporting IMDb IDs until the
+// capabilities are refreshed.
+func (c *Torznab) downgrade(ctx context.Context, err error, imdbID, function string) bool {
+	var terr *TorznabError
+	if !errors.As(err, &terr) || !terr.Unsupported() {
+		return false
+	}
+
+	c.lock.Lock()
+	if c.caps != nil {
+		search := &c.caps.MovieSearch
+		if function == "tvsearch" {
+			search = &c.caps.TVSearch
+		}
+		var params []string
+		for _, p := range search.Params {
+			if !strings.EqualFold(p, "imdbid") {
+				params = append(params, p)
+			}
+		}
+		search.Params = params
+	}
+	c.lock.Unlock()
+
+	ContextLogger(ctx, c.logger).Info("indexer rejected IMDb ID search, searching by title",
+		zap.String("provider", c.name), zap.String("id", imdbID), zap.Error(err))
+	return true
+}
+
+// Caps returns the capabilities of the indexer, refreshed every CapsAge.
+// The fetch runs without holding the lock, so searches with fresh caps
+// don't wait for a slow indexer; concurrent refreshes may both fetch.
+func (c *Torznab) Caps(ctx context.Context) (TorznabCaps, error) {
+	c.lock.Lock()
+	if c.caps != nil && c.clock.Now().Sub(c.capsFetch) <= c.capsAge {
+		caps := c.caps.clone()
+		c.lock.Unlock()
+		return caps, nil
+	}
+	c.lock.Unlock()
+
+	type search struct {
+		Available       string `xml:"available,attr"`
+		SupportedParams string `xml:"supportedParams,attr"`
+	}
+	var v struct {
+		Server struct {
+			Version string `xml:"version,attr"`
+		} `xml:"server"`
+		Searching struct {
+			Search      search `xml:"search"`
+			TVSearch    search `xml:"tv-search"`
+			MovieSearch search `xml:"movie-search"`
+		} `xml:"searching"`
+		Categories []struct {
+			ID     string `xml:"id,attr"`
+			Subcat []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"subcat"`
+		} `xml:"categories>category"`
+	}
+	if err := c.get(ctx, url.Values{"t": {"caps"}}, &v); err != nil {
+		return TorznabCaps{}, fmt.Errorf("couldn't get capabilities: %v", err)
+	}
+
+	toSearch := func(s search) TorznabSearch {
+		var params []string
+		for _, p := range strings.Split(s.SupportedParams, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				params = append(params, p)
+			}
+		}
+		return TorznabSearch{Available: s.Available == "yes", Params: params}
+	}
+	caps := TorznabCaps{
+		Version:     v.Server.Version,
+		Search:      toSearch(v.Searching.Search),
+		TVSearch:    toSearch(v.Searching.TVSearch),
+		MovieSearch: toSearch(v.Searching.MovieSearch),
+	}
+	for _, cat := range v.Categories {
+		caps.Categories = append(caps.Categories, cat.ID)
+		for _, sub := range cat.Subcat {
+			caps.Categories = append(caps.Categories, sub.ID)
+		}
+	}
+
+	c.lock.Lock()
+	c.caps = &caps
+	c.capsFetch = c.clock.Now()
+	c.lock.Unlock()
+
+	return caps, nil
+}
+
+func (c *Torznab) find(ctx context.Context, key CacheKey, params url.Values) ([]Result, error) {
+	key.Provider = c.name
+	key.Query = params.Get("q")
+	key.Params = params
+	cacheKey := key.String()
+	torrentList, created, found, err := c.cache.Get(cacheKey)
+	if err != nil {
+		ContextLogger(ctx, c.logger).Error("couldn't get torrent results from cache", zap.Error(err))
+	}
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, c.name, cacheKey, found, hit)
+	if hit {
+		return torrentList, nil
+	}
+
+	var v struct {
+		Items []struct {
+			Title     string `xml:"title"`
+			Link      string `xml:"link"`
+			Size      int    `xml:"size"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Length int    `xml:"length,attr"`
+			} `xml:"enclosure"`
+			Attrs []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value,attr"`
+			} `xml:"attr"`
+		} `xml:"channel>item"`
+	}
+	if err = c.get(ctx, params, &v); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, item := range v.Items {
+		name := cleanName(item.Title)
+		quality := qualityFromName(name)
+		if quality == "" {
+			continue
+		}
+
+		attrs := map[string]string{}
+		for _, attr := range item.Attrs {
+			attrs[attr.Name] = attr.Value
+		}
+		magnetURL := attrs["magneturl"]
+		for _, link := range []string{item.Link, item.Enclosure.URL} {
+			if magnetURL == "" && strings.HasPrefix(link, "magnet:") {
+				magnetURL = link
+			}
+		}
+		infoHash := normalizeInfoHash(attrs["infohash"])
+		if infoHash == "" {
+			infoHash = infoHashFromMagnet(magnetURL)
+		}
+		if infoHash == "" {
+			continue
+		}
+		if magnetURL == "" {
+			magnetURL = createMagnetURL(ctx, infoHash, name, nil)
+		}
+
+		size := item.Size
+		if size == 0 {
+			size, _ = strconv.Atoi(attrs["size"])
+		}
+		if size == 0 {
+			size = item.Enclosure.Length
+		}
+		seeders, _ := strconv.Atoi(attrs["seeders"])
+
+		results = append(results, Result{
+			Name:      name,
+			Quality:   quality,
+			InfoHash:  infoHash,
+			MagnetURL: magnetURL,
+			Provider:  c.name,
+			Size:      size,
+			Seeders:   seeders,
+		})
+	}
+
+	storeResults(ctx, c.cache, c.logger, c.name, cacheKey, results)
+
+	return results, nil
+}
+
+// get requests the API with params and decodes the response into v,
+// returning a *TorznabError for error responses.
+func (c *Torznab) get(ctx context.Context, params url.Values, v interface{}) error {
+	apiKey, err := credentials.Resolve(ctx, c.creds, "torznab", c.apiKey)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if apiKey != "" {
+		query.Set("apikey", apiKey)
+	}
+
+	reqURL := c.baseURL + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return requestError("create request for", reqURL, err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError("GET", reqURL, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	// Indexers answer errors with an error document, with status 200 or not,
+	// so the root element decides how the rest is decoded.
+	decoder := xml.NewDecoder(io.LimitReader(res.Body, maxBodySize))
+	root, err := rootElement(decoder)
+	if err == nil && root.Name.Local == "error" {
+		var e struct {
+			Code        int    `xml:"code,attr"`
+			Description string `xml:"description,attr"`
+		}
+		if err = decoder.DecodeElement(&e, &root); err == nil {
+			return &TorznabError{Code: e.Code, Description: e.Description}
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad GET response: %v", res.StatusCode)
+	}
+	if err == nil {
+		err = decoder.DecodeElement(v, &root)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't decode response: %v", err)
+	}
+	return nil
+}
+
+// rootElement reads up to the root element of an XML document.
+func rootElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// Capabilities are the advertised capabilities of the indexer, as of the
+// last fetch. Before the first search all searches are assumed.
+func (c *Torznab) Capabilities() Capabilities {
+	c.lock.Lock()
+	var caps *TorznabCaps
+	if c.caps != nil {
+		copied := c.caps.clone()
+		caps = &copied
+	}
+	c.lock.Unlock()
+	if caps == nil {
+		return Capabilities{
+			IMDbSearch:  true,
+			TitleSearch: true,
+			Movies:      true,
+			Episodes:    true,
+			Categories:  []string{jackettMovieCategory, jackettTVCategory},
+		}
+	}
+	return Capabilities{
+		IMDbSearch:  caps.MovieSearch.Supports("imdbid") || caps.TVSearch.Supports("imdbid"),
+		TitleSearch: caps.Search.Supports("q") || caps.MovieSearch.Supports("q") || caps.TVSearch.Supports("q"),
+		Movies:      caps.MovieSearch.Available || caps.Search.Available,
+		Episodes:    caps.TVSearch.Available || caps.Search.Available,
+		Categories:  caps.Categories,
+	}
+}
+
+func (c *Torznab) Name() string {
+	return c.name
+}
@@ -0,0 +1,52 @@
+package torrent_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func TestTorznabConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("apikey") != "key" {
+			fmt.Fprint(w, `<error code="100" description="Incorrect user credentials"/>`)
+			return
+		}
+		switch {
+		case query.Get("t") == "caps":
+			fmt.Fprint(w, `<caps><server version="1.0"/><searching>
+				<search available="yes" supportedParams="q"/>
+				<tv-search available="yes" supportedParams="q,season,ep"/>
+				<movie-search available="yes" supportedParams="q,imdbid"/>
+			</searching><categories><category id="2000"><subcat id="2040"/></category><category id="5000"/></categories></caps>`)
+		case query.Get("t") == "movie" && query.Get("imdbid") == movieID[2:]:
+			fmt.Fprint(w, `<rss><channel>
+				<item><title>Big.Buck.Bunny.2008.1080p.BluRay.x264</title><size>1000</size>
+					<attr name="infohash" value="0123456789ABCDEF0123456789ABCDEF01234567"/><attr name="seeders" value="10"/></item>
+				<item><title>Big.Buck.Bunny.2008.720p.WEB</title>
+					<link>magnet:?xt=urn:btih:1123456789abcdef0123456789abcdef01234567&amp;dn=bbb</link></item>
+			</channel></rss>`)
+		case query.Get("t") == "tvsearch" && query.Get("q") == "Pioneer One" && query.Get("season") == "1" && query.Get("ep") == "1":
+			fmt.Fprint(w, `<rss><channel>
+				<item><title>Pioneer.One.S01E01.720p.HDTV.x264</title>
+					<attr name="magneturl" value="magnet:?xt=urn:btih:2123456789abcdef0123456789abcdef01234567&amp;dn=p1"/></item>
+			</channel></rss>`)
+		default:
+			fmt.Fprint(w, `<rss><channel></channel></rss>`)
+		}
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultTorznabOpts
+		opts.BaseURL = server.URL
+		opts.APIKey = "key"
+		return torrent.NewTorznab(opts, cache, fakeMeta{}, zap.NewNop())
+	})
+}
@@ -3,14 +3,13 @@ package torrent
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/tidwall/gjson"
+	"github.com/jelliflix/imdb/parse"
 	"go.uber.org/zap"
 )
 
@@ -30,6 +29,14 @@ type TPBOptions struct {
 	SocksProxyAddr string
 	Timeout        time.Duration
 	CacheAge       time.Duration
+	Hooks          Hooks
+
+	// Clock is the time source of cache ages, SystemClock if nil.
+	Clock Clock
+
+	// EpisodeTolerance keeps episode results whose numbering disagrees
+	// with the requested one as long as they carry the episode title.
+	EpisodeTolerance bool
 }
 
 var DefaultTPBOpts = TPBOptions{
@@ -38,41 +45,64 @@ var DefaultTPBOpts = TPBOptions{
 	CacheAge: 24 * time.Hour,
 }
 
-var _ MagnetFinder = (*tpb)(nil)
+var (
+	_ Provider     = (*TPB)(nil)
+	_ SeasonFinder = (*TPB)(nil)
+)
 
-type tpb struct {
-	baseURL    string
+type TPB struct {
+	baseURL    *mirror
 	httpClient *http.Client
 	cache      Cache
 	cacheAge   time.Duration
+	clock      Clock
 	metaGetter MetaGetter
 	logger     *zap.Logger
+	tolerant   bool
 }
 
-func NewTPB(opts TPBOptions, cache Cache, metaGetter MetaGetter, logger *zap.Logger) *tpb {
-	return &tpb{
-		baseURL: opts.BaseURL,
-		httpClient: &http.Client{
-			Timeout: opts.Timeout,
-		},
+func NewTPB(opts TPBOptions, cache Cache, metaGetter MetaGetter, logger *zap.Logger) *TPB {
+	return &TPB{
+		baseURL:    newMirror(opts.BaseURL),
+		httpClient: newHTTPClient("TPB", opts.Timeout, opts.Hooks),
 		cache:      cache,
 		cacheAge:   opts.CacheAge,
+		clock:      clockOr(opts.Clock),
 		metaGetter: metaGetter,
 		logger:     logger,
+		tolerant:   opts.EpisodeTolerance,
 	}
 }
 
-func (c *tpb) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+func (c *TPB) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
 	meta, err := c.metaGetter.GetMovie(ctx, imdbID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get movie title via Cinemeta for IMDb ID %v: %v", imdbID, err)
 	}
 	escapedQuery := imdbID
-	return c.find(ctx, imdbID, meta.Title, escapedQuery, false)
+	key := CacheKey{Provider: "TPB", ID: imdbID, Query: imdbID}
+	results, err := c.find(ctx, key, meta.Title, escapedQuery, false)
+	if err != nil {
+		return nil, err
+	}
+	// Cache hits return the cached slice, which mustn't be appended to.
+	results = append([]Result(nil), results...)
+
+	for _, query := range EditionQueries(meta.Title, meta.Year, EditionsFrom(ctx)) {
+		key.Query = query
+		editionResults, err := c.find(ctx, key, meta.Title, url.QueryEscape(query), true)
+		if err != nil {
+			ContextLogger(ctx, c.logger).Error("couldn't search edition", zap.Error(err), zap.String("query", query))
+			continue
+		}
+		results = append(results, editionResults...)
+	}
+	return results, nil
 }
 
-func (c *tpb) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
+func (c *TPB) FindEpisode(ctx context.Context, imdbID string, season, episode int) ([]Result, error) {
 	id := imdbID + ":" + strconv.Itoa(season) + ":" + strconv.Itoa(episode)
+	key := CacheKey{Provider: "TPB", ID: imdbID, Season: season, Episode: episode}
 	meta, err := c.metaGetter.GetEpisode(ctx, imdbID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get TV show title via Cinemeta for ID %v: %v", id, err)
@@ -83,18 +113,69 @@ func (c *tpb) FindEpisode(ctx context.Context, imdbID string, season, episode in
 	}
 	queryEscaped := url.QueryEscape(query)
 	queryEscaped += "&cat=208"
-	return c.find(ctx, id, meta.Title, queryEscaped, true)
+	key.Query = query
+	key.Params = url.Values{"cat": {"208"}}
+	results, err := c.find(ctx, key, meta.Title, queryEscaped, true)
+	if err != nil {
+		return nil, err
+	}
+	// The episode title costs a season lookup, so it's only fetched when
+	// it's needed to match or search.
+	var title string
+	if c.tolerant {
+		title = episodeTitle(ctx, c.metaGetter, imdbID, season, episode)
+	}
+	if results = filterEpisode(results, season, episode, title, c.tolerant); len(results) > 0 {
+		return results, nil
+	}
+	if !c.tolerant {
+		title = episodeTitle(ctx, c.metaGetter, imdbID, season, episode)
+	}
+	if title == "" {
+		return results, nil
+	}
+
+	// Specials and miniseries are often released under the episode title
+	// instead of a number.
+	query = parse.SanitizeTitle(meta.Title) + " " + parse.SanitizeTitle(title)
+	key.Query = query
+	ContextLogger(ctx, c.logger).Debug("falling back to episode title search", zap.String("query", query))
+	results, err = c.find(ctx, key, meta.Title, url.QueryEscape(query)+"&cat=208", true)
+	if err != nil {
+		return nil, err
+	}
+	return filterEpisode(results, season, episode, title, true), nil
+}
+
+func (c *TPB) FindSeason(ctx context.Context, imdbID string, season int) ([]Result, error) {
+	meta, err := c.metaGetter.GetEpisode(ctx, imdbID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get TV show title for ID %v: %v", imdbID, err)
+	}
+	query := fmt.Sprintf("%v S%02d", parse.SanitizeTitle(meta.Title), season)
+	key := CacheKey{Provider: "TPB", ID: imdbID, Season: season, Query: query, Params: url.Values{"cat": {"208"}}}
+	results, err := c.find(ctx, key, meta.Title, url.QueryEscape(query)+"&cat=208", true)
+	if err != nil {
+		return nil, err
+	}
+	return filterSeasonPacks(results, season), nil
 }
 
-func (c *tpb) find(ctx context.Context, id, title, escapedQuery string, fuzzy bool) ([]Result, error) {
-	cacheKey := id + "-TPB"
+func (c *TPB) find(ctx context.Context, key CacheKey, title, escapedQuery string, fuzzy bool) ([]Result, error) {
+	cacheKey := key.String()
 	torrentList, created, found, err := c.cache.Get(cacheKey)
-	if found && time.Since(created) <= (c.cacheAge) {
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, "TPB", cacheKey, found, hit)
+	if hit {
 		return torrentList, nil
 	}
 
-	reqUrl := c.baseURL + "/q.php?q=" + escapedQuery
-	res, err := c.httpClient.Get(reqUrl)
+	reqUrl := c.baseURL.String() + "/q.php?q=" + escapedQuery
+	req, err := http.NewRequestWithContext(ctx, "GET", reqUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't GET %v: %v", reqUrl, err)
 	}
@@ -104,53 +185,45 @@ func (c *tpb) find(ctx context.Context, id, title, escapedQuery string, fuzzy bo
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("bad GET response: %v", res.StatusCode)
 	}
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read response body: %v", err)
+	if baseURL, moved := c.baseURL.follow(res); moved {
+		ContextLogger(ctx, c.logger).Info("provider moved to mirror", zap.String("provider", "TPB"), zap.String("url", baseURL))
+	}
+	// The API sends numbers as strings.
+	var torrents []struct {
+		Name     string  `json:"name"`
+		InfoHash string  `json:"info_hash"`
+		Size     jsonInt `json:"size"`
+		Seeders  jsonInt `json:"seeders"`
+	}
+	// An empty body has no results, like an empty list.
+	if err = decodeJSON(res.Body, &torrents); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("couldn't decode response: %v", err)
 	}
-
-	torrents := gjson.ParseBytes(resBody).Array()
 	if len(torrents) == 0 {
 		return nil, nil
 	}
 
 	var results []Result
 	for _, torrent := range torrents {
-		torrentName := torrent.Get("name").String()
-		quality := ""
-		if strings.Contains(torrentName, "720p") {
-			quality = "720p"
-		} else if strings.Contains(torrentName, "1080p") {
-			quality = "1080p"
-		} else if strings.Contains(torrentName, "2160p") {
-			quality = "2160p"
-		} else {
+		torrentName := cleanName(torrent.Name)
+		quality := qualityFromName(torrentName)
+		if quality == "" {
 			continue
 		}
-		if strings.Contains(torrentName, "10bit") {
-			quality += " 10bit"
-		}
-		if strings.Contains(torrentName, "HDCAM") {
-			quality += " (⚠️cam)"
-		} else if strings.Contains(torrentName, "HDTS") || strings.Contains(torrentName, "HD-TS") {
-			quality += " (⚠️telesync)"
-		}
-		infoHash := torrent.Get("info_hash").String()
+		infoHash := normalizeInfoHash(torrent.InfoHash)
 		if infoHash == "" {
 			continue
-		} else if len(infoHash) != 40 {
-			continue
 		}
-		infoHash = strings.ToLower(infoHash)
 		magnetURL := createMagnetURL(ctx, infoHash, title, trackersTPB)
-		size := int(torrent.Get("size").Int())
-		seeders := int(torrent.Get("seeders").Int())
+		size := int(torrent.Size)
+		seeders := int(torrent.Seeders)
 		result := Result{
 			Name:      torrentName,
 			Title:     title,
 			Quality:   quality,
 			InfoHash:  infoHash,
 			MagnetURL: magnetURL,
+			Provider:  "TPB",
 			Fuzzy:     fuzzy,
 			Size:      size,
 			Seeders:   seeders,
@@ -158,9 +231,22 @@ func (c *tpb) find(ctx context.Context, id, title, escapedQuery string, fuzzy bo
 		results = append(results, result)
 	}
 
-	if err := c.cache.Set(cacheKey, results); err != nil {
-		c.logger.Error("couldn't cache torrents", zap.Error(err), zap.String("cache", "torrent"))
-	}
+	storeResults(ctx, c.cache, c.logger, "TPB", cacheKey, results)
 
 	return results, nil
 }
+
+func (c *TPB) Capabilities() Capabilities {
+	return Capabilities{
+		IMDbSearch:  true,
+		TitleSearch: true,
+		Movies:      true,
+		Episodes:    true,
+		SeasonPacks: true,
+		Categories:  []string{"208"},
+	}
+}
+
+func (c *TPB) Name() string {
+	return "TPB"
+}
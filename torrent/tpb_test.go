@@ -0,0 +1,106 @@
+package torrent_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jelliflix/imdb/meta"
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func TestTPBConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("q") {
+		case movieID:
+			fmt.Fprint(w, `[
+				{"name":"Big.Buck.Bunny.2008.1080p.BluRay.x264","info_hash":"0123456789ABCDEF0123456789ABCDEF01234567","seeders":"10","size":"1000"},
+				{"name":"Big.Buck.Bunny.2008.2160p.WEB","info_hash":"not a hash"}]`)
+		case "Pioneer One S01E01":
+			fmt.Fprint(w, `[
+				{"name":"Pioneer.One.S01E01.720p.HDTV.x264","info_hash":"1123456789abcdef0123456789abcdef01234567","seeders":"5"},
+				{"name":"Pioneer.One.S01E02.720p.HDTV.x264","info_hash":"2123456789abcdef0123456789abcdef01234567"}]`)
+		default:
+			fmt.Fprint(w, `[{"id":"0","name":"No results returned","info_hash":"0000000000000000000000000000000000000000","seeders":"0","size":"0"}]`)
+		}
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultTPBOpts
+		opts.BaseURL = server.URL
+		return torrent.NewTPB(opts, cache, fakeMeta{}, zap.NewNop())
+	})
+}
+
+type fakeSeasonMeta struct {
+	fakeMeta
+}
+
+func (fakeSeasonMeta) GetSeason(_ context.Context, seriesID string, season int) ([]meta.Meta, error) {
+	return []meta.Meta{{SeriesID: seriesID, Season: season, Episode: 5, Title: "The Christmas Invasion"}}, nil
+}
+
+// TestTPBEpisodeTitle checks that tolerant matching keeps misnumbered
+// releases by the episode title, not the series title.
+func TestTPBEpisodeTitle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"Pioneer.One.S01E99.The.Christmas.Invasion.720p.HDTV","info_hash":"0123456789abcdef0123456789abcdef01234567"},
+			{"name":"Pioneer.One.S01E98.720p.HDTV","info_hash":"1123456789abcdef0123456789abcdef01234567"}]`)
+	}))
+	defer server.Close()
+
+	opts := torrent.DefaultTPBOpts
+	opts.BaseURL = server.URL
+	opts.EpisodeTolerance = true
+	client := torrent.NewTPB(opts, torrent.NewInMemCache(), fakeSeasonMeta{}, zap.NewNop())
+
+	results, err := client.FindEpisode(context.Background(), seriesID, 1, 5)
+	if err != nil {
+		t.Fatalf("couldn't find episode: %v", err)
+	}
+	if len(results) != 1 || results[0].Name != "Pioneer.One.S01E99.The.Christmas.Invasion.720p.HDTV" {
+		t.Errorf("got %+v, want only the release with the episode title", results)
+	}
+}
+
+type countingSeasonMeta struct {
+	fakeSeasonMeta
+	seasons *int32
+}
+
+func (m countingSeasonMeta) GetSeason(ctx context.Context, seriesID string, season int) ([]meta.Meta, error) {
+	atomic.AddInt32(m.seasons, 1)
+	return m.fakeSeasonMeta.GetSeason(ctx, seriesID, season)
+}
+
+// TestTPBEpisodeTitleLazy checks that the episode title isn't looked up
+// when the numbered search finds the episode.
+func TestTPBEpisodeTitleLazy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"Pioneer.One.S01E05.720p.HDTV","info_hash":"0123456789abcdef0123456789abcdef01234567"}]`)
+	}))
+	defer server.Close()
+
+	opts := torrent.DefaultTPBOpts
+	opts.BaseURL = server.URL
+	var seasons int32
+	client := torrent.NewTPB(opts, torrent.NewInMemCache(), countingSeasonMeta{seasons: &seasons}, zap.NewNop())
+
+	results, err := client.FindEpisode(context.Background(), seriesID, 1, 5)
+	if err != nil {
+		t.Fatalf("couldn't find episode: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %+v, want the numbered release", results)
+	}
+	if n := atomic.LoadInt32(&seasons); n != 0 {
+		t.Errorf("looked up the season %v times, want 0", n)
+	}
+}
@@ -0,0 +1,154 @@
+package torrent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/credentials"
+)
+
+// Trace event kinds.
+const (
+	TraceQuery      = "query"
+	TraceRequest    = "request"
+	TraceCache      = "cache"
+	TraceCacheWrite = "cache_write"
+	TraceProvider   = "provider"
+	TraceStage      = "stage"
+	TraceToken      = "token"
+)
+
+// TraceEvent is one step of a lookup. Which fields are set depends on Kind:
+//   - query: Key and the number of providers queried as Results
+//   - request: Provider, Method, URL, Status, Duration and Error of an
+//     upstream request
+//   - cache: Provider, Key and Cache ("hit", "stale" or "miss")
+//   - cache_write: Provider, Key, Results and Error of storing results
+//   - provider: Provider, Results, Duration and Error of a finder call
+//   - stage: Stage with the number of results going In and Out
+//   - token: Provider and Error of an API token refresh
+type TraceEvent struct {
+	Time     time.Time     `json:"time"`
+	Kind     string        `json:"kind"`
+	Provider string        `json:"provider,omitempty"`
+	Method   string        `json:"method,omitempty"`
+	URL      string        `json:"url,omitempty"`
+	Status   int           `json:"status,omitempty"`
+	Key      string        `json:"key,omitempty"`
+	Cache    string        `json:"cache,omitempty"`
+	Stage    string        `json:"stage,omitempty"`
+	In       int           `json:"in,omitempty"`
+	Out      int           `json:"out,omitempty"`
+	Results  int           `json:"results,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// TraceReport is the JSON report of a traced lookup.
+type TraceReport struct {
+	RequestID string        `json:"request_id,omitempty"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration"`
+	Events    []TraceEvent  `json:"events"`
+}
+
+// TraceCollector records the events of the lookups using its context, to
+// debug why a lookup returned what it did.
+type TraceCollector struct {
+	start  time.Time
+	events []TraceEvent
+	lock   *sync.Mutex
+}
+
+func NewTraceCollector() *TraceCollector {
+	return &TraceCollector{start: time.Now(), lock: &sync.Mutex{}}
+}
+
+type traceKey struct{}
+
+// WithTrace makes lookups using ctx record their steps in c.
+func WithTrace(ctx context.Context, c *TraceCollector) context.Context {
+	return context.WithValue(ctx, traceKey{}, c)
+}
+
+func traceFrom(ctx context.Context) *TraceCollector {
+	c, _ := ctx.Value(traceKey{}).(*TraceCollector)
+	return c
+}
+
+func (c *TraceCollector) add(event TraceEvent) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *TraceCollector) Events() []TraceEvent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]TraceEvent(nil), c.events...)
+}
+
+// Report returns the events recorded so far. requestID is the ID of the
+// traced lookup, see RequestID.
+func (c *TraceCollector) Report(requestID string) TraceReport {
+	return TraceReport{
+		RequestID: requestID,
+		Start:     c.start,
+		Duration:  time.Since(c.start),
+		Events:    c.Events(),
+	}
+}
+
+// WriteJSON writes the report as indented JSON.
+func (c *TraceCollector) WriteJSON(w io.Writer, requestID string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.Report(requestID))
+}
+
+func traceQuery(ctx context.Context, key string, providers int) {
+	publish(ctx, TraceEvent{Kind: TraceQuery, Key: key, Results: providers})
+}
+
+func traceRequest(ctx context.Context, provider, method, url string, status int, duration time.Duration, err error) {
+	redacted := credentials.RedactURL(url)
+	publish(ctx, TraceEvent{Kind: TraceRequest, Provider: provider, Method: method, URL: redacted,
+		Status: status, Duration: duration, Error: strings.ReplaceAll(errorString(err), url, redacted)})
+}
+
+func traceCache(ctx context.Context, provider, key string, found, hit bool) {
+	decision := "miss"
+	if hit {
+		decision = "hit"
+	} else if found {
+		decision = "stale"
+	}
+	publish(ctx, TraceEvent{Kind: TraceCache, Provider: provider, Key: key, Cache: decision})
+}
+
+func traceCacheWrite(ctx context.Context, provider, key string, results int, err error) {
+	publish(ctx, TraceEvent{Kind: TraceCacheWrite, Provider: provider, Key: key, Results: results, Error: errorString(err)})
+}
+
+func traceProvider(ctx context.Context, provider string, results int, duration time.Duration, err error) {
+	publish(ctx, TraceEvent{Kind: TraceProvider, Provider: provider, Results: results, Duration: duration, Error: errorString(err)})
+}
+
+func traceStage(ctx context.Context, stage string, in, out int) {
+	publish(ctx, TraceEvent{Kind: TraceStage, Stage: stage, In: in, Out: out})
+}
+
+func traceToken(ctx context.Context, provider string, err error) {
+	publish(ctx, TraceEvent{Kind: TraceToken, Provider: provider, Error: errorString(err)})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
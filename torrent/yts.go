@@ -3,12 +3,10 @@ package torrent
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/tidwall/gjson"
 	"go.uber.org/zap"
 )
 
@@ -27,6 +25,10 @@ type YTSOptions struct {
 	BaseURL  string
 	Timeout  time.Duration
 	CacheAge time.Duration
+	Hooks    Hooks
+
+	// Clock is the time source of cache ages, SystemClock if nil.
+	Clock Clock
 }
 
 var DefaultYTSOpts = YTSOptions{
@@ -35,41 +37,47 @@ var DefaultYTSOpts = YTSOptions{
 	CacheAge: 24 * time.Hour,
 }
 
-var _ MagnetFinder = (*yts)(nil)
+var _ Provider = (*YTS)(nil)
 
-type yts struct {
-	baseURL    string
+type YTS struct {
+	baseURL    *mirror
 	httpClient *http.Client
 	cache      Cache
 	cacheAge   time.Duration
+	clock      Clock
 	logger     *zap.Logger
 }
 
-func NewYTS(opts YTSOptions, cache Cache, logger *zap.Logger) *yts {
-	return &yts{
-		baseURL: opts.BaseURL,
-		httpClient: &http.Client{
-			Timeout: opts.Timeout,
-		},
-		cache:    cache,
-		cacheAge: opts.CacheAge,
-		logger:   logger,
+func NewYTS(opts YTSOptions, cache Cache, logger *zap.Logger) *YTS {
+	return &YTS{
+		baseURL:    newMirror(opts.BaseURL),
+		httpClient: newHTTPClient("YTS", opts.Timeout, opts.Hooks),
+		cache:      cache,
+		cacheAge:   opts.CacheAge,
+		clock:      clockOr(opts.Clock),
+		logger:     logger,
 	}
 }
 
-func (c *yts) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
-	cacheKey := imdbID + "-YTS"
+func (c *YTS) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
+	cacheKey := CacheKey{Provider: "YTS", ID: imdbID}.String()
 	torrentList, created, found, err := c.cache.Get(cacheKey)
 	if err != nil {
-		c.logger.Error("couldn't get torrent results from cache", zap.Error(err))
+		ContextLogger(ctx, c.logger).Error("couldn't get torrent results from cache", zap.Error(err))
 	}
 
-	if found && time.Since(created) <= (c.cacheAge) {
+	hit := found && c.clock.Now().Sub(created) <= c.cacheAge
+	traceCache(ctx, "YTS", cacheKey, found, hit)
+	if hit {
 		return torrentList, nil
 	}
 
-	url := c.baseURL + "/api/v2/list_movies.json?query_term=" + imdbID
-	res, err := c.httpClient.Get(url)
+	url := c.baseURL.String() + "/api/v2/list_movies.json?query_term=" + imdbID
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't GET %v: %v", url, err)
 	}
@@ -79,34 +87,48 @@ func (c *yts) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("bad GET response: %v", res.StatusCode)
 	}
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't read response body: %v", err)
+	if baseURL, moved := c.baseURL.follow(res); moved {
+		ContextLogger(ctx, c.logger).Info("provider moved to mirror", zap.String("provider", "YTS"), zap.String("url", baseURL))
+	}
+	var v struct {
+		Data struct {
+			Movies []struct {
+				Title    string `json:"title"`
+				Torrents []struct {
+					Hash      string  `json:"hash"`
+					Quality   string  `json:"quality"`
+					Type      string  `json:"type"`
+					Seeds     jsonInt `json:"seeds"`
+					SizeBytes jsonInt `json:"size_bytes"`
+				} `json:"torrents"`
+			} `json:"movies"`
+		} `json:"data"`
+	}
+	// An empty body has no results, like an empty movie list.
+	if err = decodeJSON(res.Body, &v); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("couldn't decode response: %v", err)
 	}
 
-	torrents := gjson.GetBytes(resBody, "data.movies.0.torrents").Array()
-	if len(torrents) == 0 {
+	if len(v.Data.Movies) == 0 || len(v.Data.Movies[0].Torrents) == 0 {
 		return nil, nil
 	}
-	title := gjson.GetBytes(resBody, "data.movies.0.title").String()
+	movie := v.Data.Movies[0]
+	title := cleanName(movie.Title)
 	var results []Result
-	for _, torrent := range torrents {
-		quality := torrent.Get("quality").String()
+	for _, torrent := range movie.Torrents {
+		quality := torrent.Quality
 		if quality == "720p" || quality == "1080p" || quality == "2160p" {
-			infoHash := torrent.Get("hash").String()
+			infoHash := normalizeInfoHash(torrent.Hash)
 			if infoHash == "" {
 				continue
-			} else if len(infoHash) != 40 {
-				continue
 			}
-			infoHash = strings.ToLower(infoHash)
 			magnetURL := createMagnetURL(ctx, infoHash, title, trackersYTS)
-			ripType := torrent.Get("type").String()
+			ripType := torrent.Type
 			if ripType != "" {
 				quality += " (" + ripType + ")"
 			}
-			size := int(torrent.Get("size_bytes").Int())
-			seeders := int(torrent.Get("seeds").Int())
+			size := int(torrent.SizeBytes)
+			seeders := int(torrent.Seeds)
 
 			result := Result{
 				Name:      title + " [" + quality + "] [YTS]",
@@ -114,6 +136,7 @@ func (c *yts) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
 				Quality:   quality,
 				InfoHash:  infoHash,
 				MagnetURL: magnetURL,
+				Provider:  "YTS",
 				Size:      size,
 				Seeders:   seeders,
 			}
@@ -121,13 +144,19 @@ func (c *yts) FindMovie(ctx context.Context, imdbID string) ([]Result, error) {
 		}
 	}
 
-	if err := c.cache.Set(cacheKey, results); err != nil {
-		c.logger.Error("couldn't cache torrents", zap.Error(err), zap.String("cache", "torrent"))
-	}
+	storeResults(ctx, c.cache, c.logger, "YTS", cacheKey, results)
 
 	return results, nil
 }
 
-func (c *yts) FindEpisode(_ context.Context, _ string, _, _ int) ([]Result, error) {
+func (c *YTS) FindEpisode(_ context.Context, _ string, _, _ int) ([]Result, error) {
 	return nil, nil
 }
+
+func (c *YTS) Capabilities() Capabilities {
+	return Capabilities{IMDbSearch: true, Movies: true}
+}
+
+func (c *YTS) Name() string {
+	return "YTS"
+}
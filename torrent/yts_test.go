@@ -0,0 +1,31 @@
+package torrent_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jelliflix/imdb/torrent"
+	"github.com/jelliflix/imdb/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func TestYTSConformance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query_term") != movieID {
+			fmt.Fprint(w, `{"status":"ok","data":{"movie_count":0}}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","data":{"movie_count":1,"movies":[{"title":"Big Buck Bunny","torrents":[
+			{"hash":"0123456789ABCDEF0123456789ABCDEF01234567","quality":"1080p","type":"bluray","seeds":10,"size_bytes":1000},
+			{"hash":"1123456789ABCDEF0123456789ABCDEF01234567","quality":"3D"}]}]}}`)
+	}))
+	defer server.Close()
+
+	torrenttest.RunFinderTests(t, finderCases, func(t *testing.T, cache torrent.Cache) torrent.MagnetFinder {
+		opts := torrent.DefaultYTSOpts
+		opts.BaseURL = server.URL
+		return torrent.NewYTS(opts, cache, zap.NewNop())
+	})
+}
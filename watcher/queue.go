@@ -0,0 +1,291 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+// Downloader adds torrents to a torrent client, e.g. through the Web API of
+// qBittorrent or the RPC of Transmission.
+type Downloader interface {
+	AddTorrent(ctx context.Context, result torrent.Result) error
+}
+
+type DownloaderFunc func(ctx context.Context, result torrent.Result) error
+
+func (f DownloaderFunc) AddTorrent(ctx context.Context, result torrent.Result) error {
+	return f(ctx, result)
+}
+
+type QueueOptions struct {
+	// Interval is how often Run submits due items.
+	Interval time.Duration
+	// Backoff is the delay before retrying a failed add, doubled after
+	// every further failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of adds after which an item is given up,
+	// 0 for no limit.
+	MaxAttempts int
+	// Retention is how long added and failed items are kept for Items and
+	// Retry before they're evicted. Added info hashes stay in the store, so
+	// they're still skipped afterwards.
+	Retention time.Duration
+
+	// Clock is the time source of retries and of Run, torrent.SystemClock
+	// if nil.
+	Clock torrent.Clock
+}
+
+var DefaultQueueOpts = QueueOptions{
+	Interval:    time.Minute,
+	Backoff:     time.Minute,
+	MaxBackoff:  time.Hour,
+	MaxAttempts: 10,
+	Retention:   24 * time.Hour,
+}
+
+type ItemState string
+
+const (
+	ItemPending ItemState = "pending"
+	ItemAdded   ItemState = "added"
+	ItemFailed  ItemState = "failed"
+)
+
+// Item is a queued result. LastError is the error of the last failed add,
+// NextAttempt the earliest time of the next one while pending, and Finished
+// the time it was added or given up.
+type Item struct {
+	Entry       Entry
+	Result      torrent.Result
+	State       ItemState
+	Attempts    int
+	LastError   string
+	Queued      time.Time
+	NextAttempt time.Time
+	Finished    time.Time
+}
+
+// Queue submits selected results to a downloader, retrying failed adds with
+// backoff. Info hashes are only submitted once: added hashes are recorded in
+// the store, so they're also skipped after restarts. Pending items are kept
+// in memory, finished ones for QueueOptions.Retention.
+type Queue struct {
+	opts       QueueOptions
+	downloader Downloader
+	store      Store
+	clock      torrent.Clock
+	logger     *zap.Logger
+
+	items   map[string]*Item
+	lock    *sync.Mutex
+	process *sync.Mutex
+}
+
+func NewQueue(opts QueueOptions, downloader Downloader, store Store, logger *zap.Logger) *Queue {
+	clock := opts.Clock
+	if clock == nil {
+		clock = torrent.SystemClock
+	}
+	return &Queue{
+		opts:       opts,
+		downloader: downloader,
+		store:      store,
+		clock:      clock,
+		logger:     logger,
+		items:      map[string]*Item{},
+		lock:       &sync.Mutex{},
+		process:    &sync.Mutex{},
+	}
+}
+
+// queueSeries is the store series of the info hashes added by queues.
+const queueSeries = "queue"
+
+// Enqueue queues results for entry, skipping results without an info hash
+// and info hashes that are already queued or were added before. It returns
+// the number of queued results.
+func (q *Queue) Enqueue(entry Entry, results ...torrent.Result) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	queued := 0
+	for _, result := range results {
+		if result.InfoHash == "" {
+			continue
+		}
+		key := hashKey(result.InfoHash)
+		if _, ok := q.items[key]; ok {
+			continue
+		}
+		added, err := q.store.Has(queueSeries, key)
+		if err != nil {
+			return queued, fmt.Errorf("couldn't read queue state: %v", err)
+		}
+		if added {
+			continue
+		}
+
+		now := q.clock.Now()
+		q.items[key] = &Item{Entry: entry, Result: result, State: ItemPending, Queued: now, NextAttempt: now}
+		queued++
+	}
+	return queued, nil
+}
+
+// Found queues the best of results, so it can be passed to NewWatcher as
+// FoundFunc.
+func (q *Queue) Found(entry Entry, results []torrent.Result) {
+	best, ok := torrent.Best(results)
+	if !ok {
+		return
+	}
+	if _, err := q.Enqueue(entry, best); err != nil {
+		q.logger.Error("couldn't queue result", zap.Error(err), zap.String("id", entry.IMDbID))
+	}
+}
+
+// Process evicts the finished items past their retention and submits the
+// pending items that are due, in the order they were queued.
+func (q *Queue) Process(ctx context.Context) error {
+	q.process.Lock()
+	defer q.process.Unlock()
+
+	q.lock.Lock()
+	now := q.clock.Now()
+	var due []*Item
+	for key, item := range q.items {
+		switch {
+		case item.State != ItemPending:
+			if now.Sub(item.Finished) >= q.opts.Retention {
+				delete(q.items, key)
+			}
+		case !item.NextAttempt.After(now):
+			due = append(due, item)
+		}
+	}
+	q.lock.Unlock()
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Queued.Before(due[j].Queued)
+	})
+
+	for _, item := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := q.downloader.AddTorrent(ctx, item.Result)
+		if err == nil {
+			// The torrent is in the client, so a failure to record it
+			// mustn't lead to adding it again.
+			if serr := q.store.Add(queueSeries, hashKey(item.Result.InfoHash)); serr != nil {
+				torrent.ContextLogger(ctx, q.logger).Error("couldn't save queue state", zap.Error(serr))
+			}
+		}
+
+		q.lock.Lock()
+		item.Attempts++
+		if err == nil {
+			item.State = ItemAdded
+			item.LastError = ""
+			item.Finished = q.clock.Now()
+		} else {
+			item.LastError = err.Error()
+			item.NextAttempt = q.clock.Now().Add(q.backoff(item.Attempts))
+			if q.opts.MaxAttempts > 0 && item.Attempts >= q.opts.MaxAttempts {
+				item.State = ItemFailed
+				item.Finished = q.clock.Now()
+			}
+		}
+		q.lock.Unlock()
+
+		if err != nil {
+			torrent.ContextLogger(ctx, q.logger).Error("couldn't add torrent", zap.Error(err),
+				zap.String("id", item.Entry.IMDbID), zap.String("infoHash", item.Result.InfoHash), zap.Int("attempts", item.Attempts))
+		}
+	}
+
+	return nil
+}
+
+func (q *Queue) backoff(attempts int) time.Duration {
+	limit := q.opts.MaxBackoff
+	if limit <= 0 {
+		// Without a maximum, stop doubling before the duration overflows.
+		limit = math.MaxInt64 / 2
+	}
+	backoff := q.opts.Backoff
+	for i := 1; i < attempts && backoff > 0 && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
+
+// Retry makes a failed item pending again, with its attempts reset. It
+// returns false if no failed item has the info hash, e.g. because it was
+// evicted.
+func (q *Queue) Retry(infoHash string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	item, ok := q.items[hashKey(infoHash)]
+	if !ok || item.State != ItemFailed {
+		return false
+	}
+	item.State = ItemPending
+	item.Attempts = 0
+	item.NextAttempt = q.clock.Now()
+	item.Finished = time.Time{}
+	return true
+}
+
+// Items returns the state of all queued items, oldest first.
+func (q *Queue) Items() []Item {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	items := make([]Item, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Queued.Equal(items[j].Queued) {
+			return items[i].Queued.Before(items[j].Queued)
+		}
+		return strings.ToLower(items[i].Result.InfoHash) < strings.ToLower(items[j].Result.InfoHash)
+	})
+	return items
+}
+
+// Run processes the queue every QueueOptions.Interval, or every
+// DefaultQueueOpts.Interval if it isn't positive, until ctx is done.
+func (q *Queue) Run(ctx context.Context) error {
+	interval := q.opts.Interval
+	if interval <= 0 {
+		interval = DefaultQueueOpts.Interval
+	}
+
+	for {
+		if err := q.Process(ctx); err != nil && ctx.Err() == nil {
+			torrent.ContextLogger(ctx, q.logger).Error("queue processing failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.clock.After(interval):
+		}
+	}
+}
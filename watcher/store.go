@@ -0,0 +1,197 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store remembers which keys (episodes, movies, ...) were already handled
+// per series. Implementations backed by bbolt, SQLite or Redis only need
+// these two methods.
+type Store interface {
+	Has(series, key string) (bool, error)
+	Add(series, key string) error
+}
+
+// KeyLister is implemented by stores that can list the keys of a series.
+// Watcher.LoadRequests needs it to restore requested entries.
+type KeyLister interface {
+	Keys(series string) ([]string, error)
+}
+
+var (
+	_ Store     = (*MemStore)(nil)
+	_ KeyLister = (*MemStore)(nil)
+	_ Store     = (*FileStore)(nil)
+	_ KeyLister = (*FileStore)(nil)
+)
+
+type MemStore struct {
+	data map[string]map[string]bool
+	*sync.RWMutex
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		map[string]map[string]bool{}, &sync.RWMutex{},
+	}
+}
+
+func (s *MemStore) Has(series, key string) (bool, error) {
+	s.RWMutex.RLock()
+	defer s.RWMutex.RUnlock()
+	return s.data[series][key], nil
+}
+
+func (s *MemStore) Add(series, key string) error {
+	s.RWMutex.Lock()
+	defer s.RWMutex.Unlock()
+	if s.data[series] == nil {
+		s.data[series] = map[string]bool{}
+	}
+	s.data[series][key] = true
+	return nil
+}
+
+func (s *MemStore) Keys(series string) ([]string, error) {
+	s.RWMutex.RLock()
+	defer s.RWMutex.RUnlock()
+	keys := make([]string, 0, len(s.data[series]))
+	for key := range s.data[series] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// FileStore is a Store persisted as a JSON lines file, appended to on every
+// Add. Files written as a single JSON map by earlier versions are converted
+// when opened.
+type FileStore struct {
+	path string
+	mem  *MemStore
+	lock *sync.Mutex
+}
+
+type fileStoreEntry struct {
+	Series string `json:"series"`
+	Key    string `json:"key"`
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, mem: NewMemStore(), lock: &sync.Mutex{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't read store %v: %v", path, err)
+	}
+
+	var legacy map[string]map[string]bool
+	if json.Unmarshal(data, &legacy) == nil {
+		for series, keys := range legacy {
+			for key := range keys {
+				_ = s.mem.Add(series, key)
+			}
+		}
+		if err = s.rewrite(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry fileStoreEntry
+		// Skip lines torn by a crash during a write.
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Series != "" {
+			_ = s.mem.Add(entry.Series, entry.Key)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't decode store %v: %v", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Has(series, key string) (bool, error) {
+	return s.mem.Has(series, key)
+}
+
+func (s *FileStore) Keys(series string) ([]string, error) {
+	return s.mem.Keys(series)
+}
+
+func (s *FileStore) Add(series, key string) error {
+	line, err := json.Marshal(fileStoreEntry{Series: series, Key: key})
+	if err != nil {
+		return fmt.Errorf("couldn't encode store entry: %v", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ok, _ := s.mem.Has(series, key); ok {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("couldn't open store: %v", err)
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("couldn't write store: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("couldn't write store: %v", err)
+	}
+
+	return s.mem.Add(series, key)
+}
+
+// rewrite replaces the file with the entries of s.mem in the JSON lines
+// format.
+func (s *FileStore) rewrite() error {
+	var data []byte
+	s.mem.RWMutex.RLock()
+	for series, keys := range s.mem.data {
+		for key := range keys {
+			line, err := json.Marshal(fileStoreEntry{Series: series, Key: key})
+			if err != nil {
+				s.mem.RWMutex.RUnlock()
+				return fmt.Errorf("couldn't encode store entry: %v", err)
+			}
+			data = append(append(data, line...), '\n')
+		}
+	}
+	s.mem.RWMutex.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("couldn't create temp file: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("couldn't write store: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("couldn't write store: %v", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
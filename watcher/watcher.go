@@ -0,0 +1,285 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	Interval time.Duration
+
+	// SkipDelivered drops results whose info hash was already delivered
+	// for the same series, e.g. a season pack found again for the next
+	// episode. Delivered hashes are recorded in the store.
+	SkipDelivered bool
+
+	// UpgradesOnly only reports results that rank above Entry.Have by
+	// quality, e.g. a 2160p release for a 1080p file, turning the watcher
+	// into an upgrade finder for an existing library.
+	UpgradesOnly bool
+}
+
+var DefaultOptions = Options{
+	Interval: time.Hour,
+}
+
+// Entry is a wanted movie, or an episode when Season is set, in which
+// case IMDbID is the series ID. Have is the release name of the file
+// already owned, if any.
+type Entry struct {
+	IMDbID  string
+	Season  int
+	Episode int
+	Have    string
+}
+
+func (e Entry) IsEpisode() bool {
+	return e.Season > 0 || e.Episode > 0
+}
+
+func hashKey(infoHash string) string {
+	return "hash:" + strings.ToLower(infoHash)
+}
+
+// key identifies the entry in the store. Owned entries include the owned
+// release, so replacing the file makes the entry wanted again.
+func (e Entry) key() string {
+	key := "movie"
+	if e.IsEpisode() {
+		key = fmt.Sprintf("S%02dE%02d", e.Season, e.Episode)
+	}
+	if e.Have != "" {
+		key += ">" + strings.ToLower(e.Have)
+	}
+	return key
+}
+
+type FoundFunc func(entry Entry, results []torrent.Result)
+
+type Watcher struct {
+	opts    Options
+	finder  torrent.MagnetFinder
+	store   Store
+	onFound FoundFunc
+	logger  *zap.Logger
+	entries []Entry
+	lock    *sync.Mutex
+}
+
+func NewWatcher(opts Options, finder torrent.MagnetFinder, store Store, onFound FoundFunc, logger *zap.Logger) *Watcher {
+	return &Watcher{
+		opts:    opts,
+		finder:  finder,
+		store:   store,
+		onFound: onFound,
+		logger:  logger,
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (w *Watcher) Add(entries ...Entry) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.entries = append(w.entries, entries...)
+}
+
+// requestSeries is the store series of the entries added by Request.
+const requestSeries = "request"
+
+// requestKey identifies a requested entry in the store.
+func (e Entry) requestKey() string {
+	if e.IsEpisode() {
+		return fmt.Sprintf("%v:%v:%v", e.IMDbID, e.Season, e.Episode)
+	}
+	return e.IMDbID
+}
+
+func parseRequestKey(key string) (Entry, error) {
+	parts := strings.Split(key, ":")
+	switch len(parts) {
+	case 1:
+		return Entry{IMDbID: parts[0]}, nil
+	case 3:
+		season, serr := strconv.Atoi(parts[1])
+		episode, eerr := strconv.Atoi(parts[2])
+		if serr == nil && eerr == nil {
+			return Entry{IMDbID: parts[0], Season: season, Episode: episode}, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("invalid request key %q", key)
+}
+
+// Request adds entries like Add and records them in the store, so
+// LoadRequests watches them again after a restart. Stores that don't
+// implement KeyLister can't list them, so they're only kept in memory then.
+func (w *Watcher) Request(entries ...Entry) error {
+	if _, ok := w.store.(KeyLister); ok {
+		for _, entry := range entries {
+			if err := w.store.Add(requestSeries, entry.requestKey()); err != nil {
+				return fmt.Errorf("couldn't save request: %v", err)
+			}
+		}
+	}
+	w.Add(entries...)
+	return nil
+}
+
+// LoadRequests adds the entries recorded by Request, e.g. at startup. It
+// does nothing if the store doesn't implement KeyLister.
+func (w *Watcher) LoadRequests() error {
+	lister, ok := w.store.(KeyLister)
+	if !ok {
+		return nil
+	}
+	keys, err := lister.Keys(requestSeries)
+	if err != nil {
+		return fmt.Errorf("couldn't read requests: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := parseRequestKey(key)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	w.Add(entries...)
+	return nil
+}
+
+// AddWatchlist adds watchlist movies and episodes, resolving episode IDs
+// to their series, season and episode numbers.
+func (w *Watcher) AddWatchlist(ctx context.Context, movies, episodes []string, metaGetter torrent.MetaGetter) error {
+	for _, id := range movies {
+		w.Add(Entry{IMDbID: id})
+	}
+
+	for _, id := range episodes {
+		m, err := metaGetter.GetEpisode(ctx, id)
+		if err != nil {
+			return fmt.Errorf("couldn't get episode meta for %v: %v", id, err)
+		}
+		w.Add(Entry{IMDbID: m.SeriesID, Season: m.Season, Episode: m.Episode})
+	}
+
+	return nil
+}
+
+// Check looks up every entry that wasn't grabbed yet and announces the ones
+// with results. Announced entries are recorded in the store, so they are
+// skipped on later checks and after restarts.
+func (w *Watcher) Check(ctx context.Context) error {
+	w.lock.Lock()
+	entries := append([]Entry(nil), w.entries...)
+	w.lock.Unlock()
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		grabbed, err := w.store.Has(entry.IMDbID, entry.key())
+		if err != nil {
+			return fmt.Errorf("couldn't read watch state: %v", err)
+		}
+		if grabbed {
+			continue
+		}
+
+		var results []torrent.Result
+		if entry.IsEpisode() {
+			results, err = w.finder.FindEpisode(ctx, entry.IMDbID, entry.Season, entry.Episode)
+		} else {
+			results, err = w.finder.FindMovie(ctx, entry.IMDbID)
+		}
+		if err != nil {
+			torrent.ContextLogger(ctx, w.logger).Error("couldn't find torrents", zap.Error(err), zap.String("id", entry.IMDbID))
+			// Results of the providers that didn't fail are still used.
+			if len(results) == 0 {
+				continue
+			}
+		}
+		if w.opts.UpgradesOnly {
+			results = upgrades(entry.Have, results)
+		}
+		if w.opts.SkipDelivered {
+			if results, err = w.undelivered(entry.IMDbID, results); err != nil {
+				return err
+			}
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		w.onFound(entry, results)
+		if err = w.store.Add(entry.IMDbID, entry.key()); err != nil {
+			return fmt.Errorf("couldn't save watch state: %v", err)
+		}
+		if w.opts.SkipDelivered {
+			for _, result := range results {
+				if err = w.store.Add(entry.IMDbID, hashKey(result.InfoHash)); err != nil {
+					return fmt.Errorf("couldn't save watch state: %v", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// undelivered drops the results already delivered for series.
+func (w *Watcher) undelivered(series string, results []torrent.Result) ([]torrent.Result, error) {
+	var kept []torrent.Result
+	for _, result := range results {
+		delivered, err := w.store.Has(series, hashKey(result.InfoHash))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read watch state: %v", err)
+		}
+		if !delivered {
+			kept = append(kept, result)
+		}
+	}
+	return kept, nil
+}
+
+// upgrades keeps the results that are a quality upgrade over have.
+func upgrades(have string, results []torrent.Result) []torrent.Result {
+	var kept []torrent.Result
+	for _, result := range results {
+		if torrent.IsUpgrade(have, result) {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
+
+// Run checks the entries every Options.Interval, or every
+// DefaultOptions.Interval if it isn't positive, until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.opts.Interval
+	if interval <= 0 {
+		interval = DefaultOptions.Interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Check(ctx); err != nil && ctx.Err() == nil {
+			torrent.ContextLogger(ctx, w.logger).Error("watch check failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package watcher
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jelliflix/imdb/torrent"
+	"go.uber.org/zap"
+)
+
+// IDResolver maps the TMDB/TVDB IDs sent by request systems to IMDb IDs.
+type IDResolver interface {
+	IMDbID(ctx context.Context, mediaType, tmdbID, tvdbID string) (string, error)
+}
+
+type IDResolverFunc func(ctx context.Context, mediaType, tmdbID, tvdbID string) (string, error)
+
+func (f IDResolverFunc) IMDbID(ctx context.Context, mediaType, tmdbID, tvdbID string) (string, error) {
+	return f(ctx, mediaType, tmdbID, tvdbID)
+}
+
+type WebhookOptions struct {
+	// Authorization must match the request's Authorization header when set.
+	Authorization string
+}
+
+// webhookPayload is the default Overseerr/Jellyseerr webhook template.
+// An "imdbId" field can be added to the media object of the template to
+// skip ID resolution.
+type webhookPayload struct {
+	NotificationType string `json:"notification_type"`
+	Media            *struct {
+		MediaType string `json:"media_type"`
+		TMDBID    string `json:"tmdbId"`
+		TVDBID    string `json:"tvdbId"`
+		IMDbID    string `json:"imdbId"`
+	} `json:"media"`
+	Extra []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"extra"`
+}
+
+type webhook struct {
+	opts     WebhookOptions
+	watcher  *Watcher
+	resolver IDResolver
+	seasons  torrent.SeasonGetter
+	logger   *zap.Logger
+}
+
+// NewWebhookHandler returns a handler accepting Overseerr/Jellyseerr
+// webhooks and adding approved requests to the watcher with
+// Watcher.Request, so they're persisted in its store. seasons may be nil
+// if only movies are requested; series requests are rejected then.
+func NewWebhookHandler(opts WebhookOptions, w *Watcher, resolver IDResolver, seasons torrent.SeasonGetter, logger *zap.Logger) http.Handler {
+	return &webhook{
+		opts:     opts,
+		watcher:  w,
+		resolver: resolver,
+		seasons:  seasons,
+		logger:   logger,
+	}
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.opts.Authorization != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(h.opts.Authorization)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload webhookPayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("couldn't decode payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch payload.NotificationType {
+	case "MEDIA_APPROVED", "MEDIA_AUTO_APPROVED":
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := r.Context()
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		ctx = torrent.WithRequestID(ctx, id)
+	}
+
+	entries, err := h.entries(ctx, payload)
+	if err != nil {
+		torrent.ContextLogger(ctx, h.logger).Error("couldn't handle media request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err = h.watcher.Request(entries...); err != nil {
+		torrent.ContextLogger(ctx, h.logger).Error("couldn't add media request", zap.Error(err))
+		http.Error(w, "couldn't add media request", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *webhook) entries(ctx context.Context, payload webhookPayload) ([]Entry, error) {
+	media := payload.Media
+	if media == nil {
+		return nil, fmt.Errorf("payload has no media")
+	}
+
+	id := media.IMDbID
+	if id == "" {
+		if h.resolver == nil {
+			return nil, fmt.Errorf("payload has no IMDb ID")
+		}
+		var err error
+		id, err = h.resolver.IMDbID(ctx, media.MediaType, media.TMDBID, media.TVDBID)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't resolve IMDb ID: %v", err)
+		}
+	}
+
+	if media.MediaType == "movie" {
+		return []Entry{{IMDbID: id}}, nil
+	}
+	if h.seasons == nil {
+		return nil, fmt.Errorf("can't add series %v without season metadata", id)
+	}
+
+	var seasons []int
+	for _, extra := range payload.Extra {
+		if extra.Name != "Requested Seasons" {
+			continue
+		}
+		for _, s := range strings.Split(extra.Value, ",") {
+			season, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("invalid requested season %q", s)
+			}
+			seasons = append(seasons, season)
+		}
+	}
+	if len(seasons) == 0 {
+		return nil, fmt.Errorf("no seasons requested for %v", id)
+	}
+
+	var entries []Entry
+	for _, season := range seasons {
+		episodes, err := h.seasons.GetSeason(ctx, id, season)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get season %v of %v: %v", season, id, err)
+		}
+		for _, episode := range episodes {
+			entries = append(entries, Entry{IMDbID: id, Season: season, Episode: episode.Episode})
+		}
+	}
+
+	return entries, nil
+}
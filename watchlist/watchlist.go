@@ -2,7 +2,7 @@ package watchlist
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -78,7 +78,7 @@ func (i *IMDB) request(endpoint string, params url.Values) (body []byte, err err
 		return body, fmt.Errorf("got http error %q", resp.Status)
 	}
 
-	return ioutil.ReadAll(resp.Body)
+	return io.ReadAll(resp.Body)
 }
 
 func (i *IMDB) reqWatchlist(kind, sort string, page int) (list []string, err error) {